@@ -42,7 +42,14 @@ func Init(bucket string) {
 
 //CopyFolder copy cloud storage folder to another dst
 func CopyFolder(srcFolder, dstFolder string, multiple bool) error {
-	ctx := context.Background()
+	return CopyFolderCtx(context.Background(), srcFolder, dstFolder, multiple)
+}
+
+//CopyFolderCtx is CopyFolder with a context, no file is copied once ctx is done
+func CopyFolderCtx(ctx context.Context, srcFolder, dstFolder string, multiple bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// get readonly client
 	client, err := storage.NewClient(ctx)
 	if err != nil {
@@ -56,7 +63,9 @@ func CopyFolder(srcFolder, dstFolder string, multiple bool) error {
 	wg := sync.WaitGroup{}
 	errs := []error{}
 	for {
-
+		if ctx.Err() != nil {
+			break
+		}
 		attrs, err := it.Next()
 		if err != nil {
 			break
@@ -69,13 +78,13 @@ func CopyFolder(srcFolder, dstFolder string, multiple bool) error {
 		if multiple {
 			wg.Add(1)
 			go func() {
-				err = CopyFile(attrs.Name, dst)
+				err = CopyFileCtx(ctx, attrs.Name, dst)
 				errs = append(errs, err)
 				wg.Done()
 			}()
 
 		} else {
-			err = CopyFile(attrs.Name, dst)
+			err = CopyFileCtx(ctx, attrs.Name, dst)
 			if err != nil {
 				return err
 			}
@@ -84,6 +93,11 @@ func CopyFolder(srcFolder, dstFolder string, multiple bool) error {
 	}
 	if multiple {
 		wg.Wait()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if multiple {
 		for i := range errs {
 			if errs[i] != nil {
 				return err
@@ -95,8 +109,14 @@ func CopyFolder(srcFolder, dstFolder string, multiple bool) error {
 
 //CopyFile copy cloud storage file to another dst
 func CopyFile(src, dst string) error {
+	return CopyFileCtx(context.Background(), src, dst)
+}
 
-	ctx := context.Background()
+//CopyFileCtx is CopyFile with a context
+func CopyFileCtx(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return err
@@ -115,7 +135,14 @@ func CopyFile(src, dst string) error {
 
 //UploadFromReader upload from reader to GCP file
 func UploadFromReader(reader io.Reader, dst string, optionalBucket ...string) error {
-	ctx := context.Background()
+	return UploadFromReaderCtx(context.Background(), reader, dst, optionalBucket...)
+}
+
+//UploadFromReaderCtx is UploadFromReader with a context
+func UploadFromReaderCtx(ctx context.Context, reader io.Reader, dst string, optionalBucket ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return err
@@ -135,7 +162,14 @@ func UploadFromReader(reader io.Reader, dst string, optionalBucket ...string) er
 
 //GetSignedURL get signed url with expire time
 func GetSignedURL(objectPath string, duration time.Duration, optionalBucket ...string) (string, error) {
-	ctx := context.Background()
+	return GetSignedURLCtx(context.Background(), objectPath, duration, optionalBucket...)
+}
+
+//GetSignedURLCtx is GetSignedURL with a context
+func GetSignedURLCtx(ctx context.Context, objectPath string, duration time.Duration, optionalBucket ...string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	cre, err := google.FindDefaultCredentials(ctx)
 	if err != nil {
 		return "", err
@@ -167,18 +201,30 @@ func GetSignedURL(objectPath string, duration time.Duration, optionalBucket ...s
 
 //Upload local file to the current bucket
 func Upload(localFile, dst string) error {
+	return UploadCtx(context.Background(), localFile, dst)
+}
+
+//UploadCtx is Upload with a context
+func UploadCtx(ctx context.Context, localFile, dst string) error {
 	fileReader, err := os.Open(localFile)
 	if err != nil {
 		return err
 	}
 	defer fileReader.Close()
-	return UploadFromReader(fileReader, dst)
+	return UploadFromReaderCtx(ctx, fileReader, dst)
 }
 
 //GetMeta get size
 func GetMeta(src string, optionalBucket ...string) (Meta, error) {
+	return GetMetaCtx(context.Background(), src, optionalBucket...)
+}
+
+//GetMetaCtx is GetMeta with a context
+func GetMetaCtx(ctx context.Context, src string, optionalBucket ...string) (Meta, error) {
+	if err := ctx.Err(); err != nil {
+		return Meta{}, err
+	}
 	meta := Meta{}
-	ctx := context.Background()
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return meta, err
@@ -204,7 +250,12 @@ func GetMeta(src string, optionalBucket ...string) (Meta, error) {
 
 //Exists check if file exists
 func Exists(filePath string) (bool, error) {
-	md5, err := MD5(filePath)
+	return ExistsCtx(context.Background(), filePath)
+}
+
+//ExistsCtx is Exists with a context
+func ExistsCtx(ctx context.Context, filePath string) (bool, error) {
+	md5, err := MD5Ctx(ctx, filePath)
 	if err != nil {
 		return false, err
 	}
@@ -218,7 +269,14 @@ func Exists(filePath string) (bool, error) {
 //prefix can be a folder, if prefix is empty string the function will return all files in the bucket
 //limit is number of files to retrive, 0 means all
 func List(prefix string, limit int) (files []string, err error) {
-	ctx := context.Background()
+	return ListCtx(context.Background(), prefix, limit)
+}
+
+//ListCtx is List with a context
+func ListCtx(ctx context.Context, prefix string, limit int) (files []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	client, err := storage.NewClient(ctx, option.WithScopes(raw.DevstorageReadOnlyScope))
 	if err != nil {
 		return nil, err
@@ -250,7 +308,14 @@ func List(prefix string, limit int) (files []string, err error) {
 
 //GetFileReader get file reader from gcp bucket
 func GetFileReader(object string, optionalBucket ...string) (reader io.Reader, err error) {
-	ctx := context.Background()
+	return GetFileReaderCtx(context.Background(), object, optionalBucket...)
+}
+
+//GetFileReaderCtx is GetFileReader with a context, ctx is used by the reads as well
+func GetFileReaderCtx(ctx context.Context, object string, optionalBucket ...string) (reader io.Reader, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// get readonly client
 	client, err := storage.NewClient(ctx, option.WithScopes(raw.DevstorageReadOnlyScope))
 	if err != nil {
@@ -266,7 +331,14 @@ func GetFileReader(object string, optionalBucket ...string) (reader io.Reader, e
 
 //Delete storage file from the current bucket
 func Delete(filePath string) error {
-	ctx := context.Background()
+	return DeleteCtx(context.Background(), filePath)
+}
+
+//DeleteCtx is Delete with a context
+func DeleteCtx(ctx context.Context, filePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return err
@@ -278,7 +350,12 @@ func Delete(filePath string) error {
 
 //ReadFile into object
 func ReadFile(filepath string, obj interface{}) (err error) {
-	reader, err := GetFileReader(filepath)
+	return ReadFileCtx(context.Background(), filepath, obj)
+}
+
+//ReadFileCtx is ReadFile with a context
+func ReadFileCtx(ctx context.Context, filepath string, obj interface{}) (err error) {
+	reader, err := GetFileReaderCtx(ctx, filepath)
 	if err != nil {
 		return
 	}
@@ -291,7 +368,15 @@ func ReadFile(filepath string, obj interface{}) (err error) {
 
 //Download file from source (src) to local destination (dst)
 func Download(src, dst string) error {
-	reader, err := GetFileReader(src)
+	return DownloadCtx(context.Background(), src, dst)
+}
+
+//DownloadCtx is Download with a context, cancelling ctx stops the transfer
+func DownloadCtx(ctx context.Context, src, dst string) error {
+	reader, err := GetFileReaderCtx(ctx, src)
+	if err != nil {
+		return err
+	}
 	dstFile, err := os.Create(dst)
 	if err != nil {
 		return err
@@ -307,7 +392,14 @@ func Download(src, dst string) error {
 
 //Attrs returns the metadata for the bucket.
 func Attrs(filePath string) (attrs *storage.ObjectAttrs, err error) {
-	ctx := context.Background()
+	return AttrsCtx(context.Background(), filePath)
+}
+
+//AttrsCtx is Attrs with a context
+func AttrsCtx(ctx context.Context, filePath string) (attrs *storage.ObjectAttrs, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// get readonly client
 	client, err := storage.NewClient(ctx, option.WithScopes(raw.DevstorageReadOnlyScope))
 	if err != nil {
@@ -322,7 +414,14 @@ func Attrs(filePath string) (attrs *storage.ObjectAttrs, err error) {
 
 //DeleteFolder delete all files under folder
 func DeleteFolder(folder string) error {
-	ctx := context.Background()
+	return DeleteFolderCtx(context.Background(), folder)
+}
+
+//DeleteFolderCtx is DeleteFolder with a context, ctx is checked between files
+func DeleteFolderCtx(ctx context.Context, folder string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// get readonly client
 	client, err := storage.NewClient(ctx)
 	if err != nil {
@@ -334,22 +433,34 @@ func DeleteFolder(folder string) error {
 		Prefix: folder,
 	})
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		attrs, err := it.Next()
-		if err != nil {
+		if err == iterator.Done {
 			return nil
 		}
+		if err != nil {
+			return err
+		}
 
 		err = bucket.Object(attrs.Name).Delete(ctx)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
 }
 
 //DeleteOldFiles delete files from folder based on their age, time from created date
 func DeleteOldFiles(folder string, fileAge time.Duration) error {
-	ctx := context.Background()
+	return DeleteOldFilesCtx(context.Background(), folder, fileAge)
+}
+
+//DeleteOldFilesCtx is DeleteOldFiles with a context, ctx is checked between files
+func DeleteOldFilesCtx(ctx context.Context, folder string, fileAge time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// get readonly client
 	client, err := storage.NewClient(ctx)
 	if err != nil {
@@ -362,6 +473,9 @@ func DeleteOldFiles(folder string, fileAge time.Duration) error {
 	})
 	now := time.Now()
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		attrs, err := it.Next()
 		if err == iterator.Done {
 			break
@@ -381,7 +495,12 @@ func DeleteOldFiles(folder string, fileAge time.Duration) error {
 
 //Size get the size of the file in int64
 func Size(filePath string) (size int64, err error) {
-	attrs, err := Attrs(filePath)
+	return SizeCtx(context.Background(), filePath)
+}
+
+//SizeCtx is Size with a context
+func SizeCtx(ctx context.Context, filePath string) (size int64, err error) {
+	attrs, err := AttrsCtx(ctx, filePath)
 	if err != nil {
 		return
 	}
@@ -391,7 +510,14 @@ func Size(filePath string) (size int64, err error) {
 
 //MakePublic make file public (readonly) and retrive the download url
 func MakePublic(filePath string) (downloadURL string, err error) {
-	ctx := context.Background()
+	return MakePublicCtx(context.Background(), filePath)
+}
+
+//MakePublicCtx is MakePublic with a context
+func MakePublicCtx(ctx context.Context, filePath string) (downloadURL string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return "", err
@@ -407,7 +533,12 @@ func MakePublic(filePath string) (downloadURL string, err error) {
 
 //MD5 get the md5 checksum of a file in a bucket
 func MD5(filePath string) (md5String string, err error) {
-	attrs, err := Attrs(filePath)
+	return MD5Ctx(context.Background(), filePath)
+}
+
+//MD5Ctx is MD5 with a context
+func MD5Ctx(ctx context.Context, filePath string) (md5String string, err error) {
+	attrs, err := AttrsCtx(ctx, filePath)
 	if err != nil {
 		return
 	}
@@ -1,6 +1,8 @@
 package GCPStorage
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -170,3 +172,12 @@ func TestCopyFolder(t *testing.T) {
 	}()
 	CopyFolder(srcFolder, dstFolder, true)
 }
+
+func TestDeleteFolderCtxCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := DeleteFolderCtx(ctx, "testFiles")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expecting context.Canceled, got: %v", err)
+	}
+}
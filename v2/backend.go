@@ -0,0 +1,530 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// ErrNotSupported is returned for operations the bucket backend cannot perform,
+// for example MakePublic on a LocalFSBackend
+var ErrNotSupported = errors.New("GCPStorage: operation not supported by backend")
+
+// Backend is the storage layer behind a Bucket. Every method takes the bucket
+// name so one backend can serve several buckets. Missing objects are reported
+// with storage.ErrObjectNotExist.
+type Backend interface {
+	// NewWriter returns a writer for object, the object is committed on Close.
+	// Cancelling ctx before Close discards the written data.
+	NewWriter(ctx context.Context, bucket, object string, opts *WriterOptions) ObjectWriter
+	// NewRangeReader reads length bytes of object starting at offset,
+	// a negative length reads until the end of the object.
+	NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, error)
+	// Attrs returns the attributes of object.
+	Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error)
+	// Objects lists the objects of bucket matching q, q may be nil.
+	Objects(ctx context.Context, bucket string, q *storage.Query) ObjectIterator
+	// Copy copies srcBucket/src to dstBucket/dst, conds apply to dst and may be nil.
+	Copy(ctx context.Context, dstBucket, dst, srcBucket, src string, conds *Conditions) (*storage.ObjectAttrs, error)
+	// Compose concatenates up to MaxComposeSources objects of bucket into
+	// dst. Like composite objects of cloud storage the result has no MD5.
+	Compose(ctx context.Context, bucket, dst string, srcs []string, opts *WriterOptions) (*storage.ObjectAttrs, error)
+	// Delete removes object, conds may be nil.
+	Delete(ctx context.Context, bucket, object string, conds *Conditions) error
+	// Close releases the resources held by the backend.
+	Close() error
+}
+
+// MaxComposeSources is the number of objects a single Backend.Compose accepts
+const MaxComposeSources = 32
+
+// errComposeSources is returned by Backend.Compose for an invalid number of sources
+var errComposeSources = fmt.Errorf("GCPStorage: compose needs 1 to %d sources", MaxComposeSources)
+
+// WriterOptions are optional attributes for Backend.NewWriter
+type WriterOptions struct {
+	ContentType string
+	// Metadata are custom key/value pairs stored with the object
+	Metadata map[string]string
+	// ChunkSize is the upload buffer size, zero uses the backend default and
+	// a negative value uploads in a single request without buffering.
+	ChunkSize int
+	// CRC32C is the checksum of the data, with SendCRC32C the backend
+	// rejects the object if the data it received does not match.
+	CRC32C     uint32
+	SendCRC32C bool
+	// Conditions apply to the object being replaced, nil writes unconditionally
+	Conditions *Conditions
+}
+
+// CopyOptions are optional attributes for VersionedBackend.CopyGeneration
+type CopyOptions struct {
+	// Metadata replaces the custom metadata of the copy, nil keeps the
+	// metadata of the source
+	Metadata map[string]string
+	// Conditions apply to the destination object, nil copies unconditionally
+	Conditions *Conditions
+}
+
+// conditions returns the conditions of o, o may be nil
+func (o *CopyOptions) conditions() *Conditions {
+	if o == nil {
+		return nil
+	}
+	return o.Conditions
+}
+
+// Conditions are preconditions on the current object, a request whose
+// conditions do not hold fails with a 412 *googleapi.Error which wrapErr
+// reports as ErrPreconditionFailed. Zero fields are not checked.
+// DoesNotExist gives create-if-absent writes, GenerationMatch gives
+// compare-and-swap.
+type Conditions struct {
+	// DoesNotExist requires that the object does not exist, writes only
+	DoesNotExist        bool
+	GenerationMatch     int64
+	MetagenerationMatch int64
+}
+
+// errPrecondition is the error of a request whose conditions do not hold
+var errPrecondition = &googleapi.Error{Code: http.StatusPreconditionFailed, Message: "conditionNotMet"}
+
+// Check returns the error a backend reports when attrs, the attributes of
+// the current object, do not satisfy c. attrs is nil when the object does
+// not exist. Backends other than GCSBackend use it, c may be nil.
+func (c *Conditions) Check(attrs *storage.ObjectAttrs) error {
+	if c == nil {
+		return nil
+	}
+	if attrs == nil {
+		if c.GenerationMatch != 0 || c.MetagenerationMatch != 0 {
+			return errPrecondition
+		}
+		return nil
+	}
+	if c.DoesNotExist {
+		return errPrecondition
+	}
+	if c.GenerationMatch != 0 && attrs.Generation != c.GenerationMatch {
+		return errPrecondition
+	}
+	if c.MetagenerationMatch != 0 && attrs.Metageneration != c.MetagenerationMatch {
+		return errPrecondition
+	}
+	return nil
+}
+
+// handle applies c to obj
+func (c *Conditions) handle(obj *storage.ObjectHandle) *storage.ObjectHandle {
+	if c == nil || *c == (Conditions{}) {
+		return obj
+	}
+	return obj.If(storage.Conditions{
+		DoesNotExist:        c.DoesNotExist,
+		GenerationMatch:     c.GenerationMatch,
+		MetagenerationMatch: c.MetagenerationMatch,
+	})
+}
+
+// ObjectWriter writes a single object
+type ObjectWriter interface {
+	io.WriteCloser
+	// Attrs returns the attributes of the written object, valid after Close succeeded.
+	Attrs() *storage.ObjectAttrs
+}
+
+// ObjectIterator iterates over object listings, Next returns iterator.Done at
+// the end. PageInfo allows paging with page tokens, *storage.ObjectIterator
+// implements it.
+type ObjectIterator interface {
+	Next() (*storage.ObjectAttrs, error)
+	PageInfo() *iterator.PageInfo
+}
+
+// URLBackend is implemented by backends which can share objects over HTTP
+type URLBackend interface {
+	// SignedURL returns a URL granting read access to object until expires.
+	SignedURL(ctx context.Context, bucket, object string, expires time.Time) (string, error)
+	// MakePublic grants everyone read access to object and returns its URL.
+	MakePublic(ctx context.Context, bucket, object string) (string, error)
+}
+
+// VersionedBackend is implemented by backends which keep the noncurrent
+// generations of objects, like buckets with object versioning. Generations
+// are listed by Backend.Objects with storage.Query.Versions.
+type VersionedBackend interface {
+	// GenerationAttrs returns the attributes of generation of object.
+	GenerationAttrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error)
+	// NewGenerationReader is Backend.NewRangeReader for generation of object.
+	NewGenerationReader(ctx context.Context, bucket, object string, generation, offset, length int64) (io.ReadCloser, error)
+	// CopyGeneration copies generation of srcBucket/src to dstBucket/dst,
+	// opts may be nil.
+	CopyGeneration(ctx context.Context, dstBucket, dst, srcBucket, src string, generation int64, opts *CopyOptions) (*storage.ObjectAttrs, error)
+	// DeleteGeneration removes generation of object for good, live or noncurrent.
+	DeleteGeneration(ctx context.Context, bucket, object string, generation int64) error
+}
+
+// DefaultEndpoint is where cloud storage serves objects
+const DefaultEndpoint = "https://storage.googleapis.com"
+
+// GCSBackend is the Backend for Google Cloud Storage
+type GCSBackend struct {
+	client   *storage.Client
+	endpoint string
+	emulator bool
+
+	// clientOpts create httpClient for resumable uploads and copies on
+	// first use, unless it is set with SetHTTPClient. apiURL is the root
+	// URL of their requests, see apiRoot.
+	mu         sync.Mutex
+	clientOpts []option.ClientOption
+	httpClient *http.Client
+	apiURL     string
+}
+
+var _ Backend = (*GCSBackend)(nil)
+var _ URLBackend = (*GCSBackend)(nil)
+var _ VersionedBackend = (*GCSBackend)(nil)
+
+// NewGCSBackend creates a backend using client, the backend owns the client and closes it on Close.
+// When STORAGE_EMULATOR_HOST is set object URLs point to the emulator.
+// Resumable uploads and copies are not sent by client but by a second HTTP
+// client with the default credentials to Endpoint, set them with
+// SetHTTPClient and SetEndpoint when client is authorized otherwise or sends
+// requests elsewhere. NewBucket and NewBucketAt build the HTTP client and
+// take the endpoint from their options.
+func NewGCSBackend(client *storage.Client) *GCSBackend {
+	g := &GCSBackend{client: client, endpoint: DefaultEndpoint}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		g.endpoint = emulatorEndpoint(host)
+		g.emulator = true
+	}
+	return g
+}
+
+// emulatorEndpoint turns STORAGE_EMULATOR_HOST into a URL, the scheme defaults to http like the storage client does
+func emulatorEndpoint(host string) string {
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// SetHTTPClient sets the HTTP client of the requests sent without the
+// storage client, resumable uploads and copies. It must be authorized for
+// the storage JSON API, e.g. with the transport of the storage client.
+func (g *GCSBackend) SetHTTPClient(client *http.Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.httpClient = client
+}
+
+// SetEndpoint sets the base URL of object URLs, e.g. "http://localhost:4443".
+// It does not change where the client sends API requests, see NewBucketAt.
+func (g *GCSBackend) SetEndpoint(endpoint string) {
+	g.endpoint = strings.TrimSuffix(endpoint, "/")
+}
+
+// Endpoint returns the base URL of object URLs
+func (g *GCSBackend) Endpoint() string {
+	return g.endpoint
+}
+
+// ObjectURL returns the path style URL of an object
+func (g *GCSBackend) ObjectURL(bucket, object string) string {
+	return g.endpoint + "/" + bucket + "/" + object
+}
+
+// SignedURL implements URLBackend. URLs for an emulator are not signed, emulators do not check signatures.
+func (g *GCSBackend) SignedURL(ctx context.Context, bucket, object string, expires time.Time) (string, error) {
+	if g.emulator {
+		return g.ObjectURL(bucket, object), nil
+	}
+	opts := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  "GET",
+		Expires: expires,
+	}
+	name := object
+	if g.endpoint != DefaultEndpoint {
+		u, err := url.Parse(g.endpoint)
+		if err != nil {
+			return "", err
+		}
+		// a bucket bound hostname signs the custom host, the bucket becomes part of the path
+		opts.Style = storage.BucketBoundHostname(u.Host)
+		opts.Insecure = u.Scheme == "http"
+		name = bucket + "/" + object
+	}
+	return g.client.Bucket(bucket).SignedURL(name, opts)
+}
+
+// MakePublic implements URLBackend
+func (g *GCSBackend) MakePublic(ctx context.Context, bucket, object string) (string, error) {
+	acl := g.client.Bucket(bucket).Object(object).ACL()
+	if err := acl.Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+		return "", err
+	}
+	return g.ObjectURL(bucket, object), nil
+}
+
+// Client returns the underlying storage client
+func (g *GCSBackend) Client() *storage.Client {
+	return g.client
+}
+
+// NewWriter implements Backend
+func (g *GCSBackend) NewWriter(ctx context.Context, bucket, object string, opts *WriterOptions) ObjectWriter {
+	obj := g.client.Bucket(bucket).Object(object)
+	if opts != nil {
+		obj = opts.Conditions.handle(obj)
+	}
+	w := obj.NewWriter(ctx)
+	if opts != nil {
+		w.ContentType = opts.ContentType
+		w.Metadata = opts.Metadata
+		if opts.ChunkSize < 0 {
+			w.ChunkSize = 0
+		} else if opts.ChunkSize > 0 {
+			w.ChunkSize = opts.ChunkSize
+		}
+		w.CRC32C = opts.CRC32C
+		w.SendCRC32C = opts.SendCRC32C
+	}
+	return w
+}
+
+// NewRangeReader implements Backend
+func (g *GCSBackend) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, error) {
+	return g.client.Bucket(bucket).Object(object).NewRangeReader(ctx, offset, length)
+}
+
+// Attrs implements Backend
+func (g *GCSBackend) Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error) {
+	return g.client.Bucket(bucket).Object(object).Attrs(ctx)
+}
+
+// Objects implements Backend
+func (g *GCSBackend) Objects(ctx context.Context, bucket string, q *storage.Query) ObjectIterator {
+	return g.client.Bucket(bucket).Objects(ctx, q)
+}
+
+// Copy implements Backend with the rewrite loop of rewrite.go
+func (g *GCSBackend) Copy(ctx context.Context, dstBucket, dst, srcBucket, src string, conds *Conditions) (*storage.ObjectAttrs, error) {
+	return g.rewrite(ctx, dstBucket, dst, srcBucket, src, 0, &CopyOptions{Conditions: conds})
+}
+
+// Compose implements Backend
+func (g *GCSBackend) Compose(ctx context.Context, bucket, dst string, srcs []string, opts *WriterOptions) (*storage.ObjectAttrs, error) {
+	if len(srcs) == 0 || len(srcs) > MaxComposeSources {
+		return nil, errComposeSources
+	}
+	b := g.client.Bucket(bucket)
+	objs := make([]*storage.ObjectHandle, len(srcs))
+	for i, src := range srcs {
+		objs[i] = b.Object(src)
+	}
+	dstObj := b.Object(dst)
+	if opts != nil {
+		dstObj = opts.Conditions.handle(dstObj)
+	}
+	composer := dstObj.ComposerFrom(objs...)
+	if opts != nil {
+		composer.ContentType = opts.ContentType
+		composer.Metadata = opts.Metadata
+	}
+	return composer.Run(ctx)
+}
+
+// Delete implements Backend
+func (g *GCSBackend) Delete(ctx context.Context, bucket, object string, conds *Conditions) error {
+	return conds.handle(g.client.Bucket(bucket).Object(object)).Delete(ctx)
+}
+
+// GenerationAttrs implements VersionedBackend
+func (g *GCSBackend) GenerationAttrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	return g.client.Bucket(bucket).Object(object).Generation(generation).Attrs(ctx)
+}
+
+// NewGenerationReader implements VersionedBackend
+func (g *GCSBackend) NewGenerationReader(ctx context.Context, bucket, object string, generation, offset, length int64) (io.ReadCloser, error) {
+	return g.client.Bucket(bucket).Object(object).Generation(generation).NewRangeReader(ctx, offset, length)
+}
+
+// CopyGeneration implements VersionedBackend with the rewrite loop of rewrite.go
+func (g *GCSBackend) CopyGeneration(ctx context.Context, dstBucket, dst, srcBucket, src string, generation int64, opts *CopyOptions) (*storage.ObjectAttrs, error) {
+	return g.rewrite(ctx, dstBucket, dst, srcBucket, src, generation, opts)
+}
+
+// DeleteGeneration implements VersionedBackend
+func (g *GCSBackend) DeleteGeneration(ctx context.Context, bucket, object string, generation int64) error {
+	return g.client.Bucket(bucket).Object(object).Generation(generation).Delete(ctx)
+}
+
+// Close implements Backend
+func (g *GCSBackend) Close() error {
+	return g.client.Close()
+}
+
+// sliceIterator is an ObjectIterator over a precomputed listing, page
+// tokens are the name (or prefix) of the last item of the previous page,
+// followed by its generation when versions are listed
+type sliceIterator struct {
+	objs     []*storage.ObjectAttrs
+	versions bool
+	err      error
+	items    []*storage.ObjectAttrs
+	pageInfo *iterator.PageInfo
+	nextFunc func() error
+}
+
+func newSliceIterator(objs []*storage.ObjectAttrs, err error) *sliceIterator {
+	it := &sliceIterator{objs: objs, err: err}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.items) },
+		func() interface{} { b := it.items; it.items = nil; return b },
+	)
+	return it
+}
+
+// listingKey orders objects and prefixes in a listing
+func listingKey(attrs *storage.ObjectAttrs) string {
+	if attrs.Name == "" {
+		return attrs.Prefix
+	}
+	return attrs.Name
+}
+
+// versionToken is the page token of a listing of versions ending with attrs,
+// several generations of a name can span two pages
+func versionToken(attrs *storage.ObjectAttrs) string {
+	return fmt.Sprintf("%s#%020d", listingKey(attrs), attrs.Generation)
+}
+
+// parseVersionToken splits a versionToken, a token without generation is
+// after every generation of the name
+func parseVersionToken(token string) (string, int64) {
+	if i := strings.LastIndex(token, "#"); i >= 0 {
+		if generation, err := strconv.ParseInt(token[i+1:], 10, 64); err == nil {
+			return token[:i], generation
+		}
+	}
+	return token, math.MaxInt64
+}
+
+func (it *sliceIterator) fetch(pageSize int, pageToken string) (string, error) {
+	if it.err != nil {
+		return "", it.err
+	}
+	after := func(attrs *storage.ObjectAttrs) bool {
+		return listingKey(attrs) > pageToken
+	}
+	if it.versions && pageToken != "" {
+		name, generation := parseVersionToken(pageToken)
+		after = func(attrs *storage.ObjectAttrs) bool {
+			key := listingKey(attrs)
+			return key > name || (key == name && attrs.Generation > generation)
+		}
+	}
+	start := sort.Search(len(it.objs), func(i int) bool {
+		return after(it.objs[i])
+	})
+	end := len(it.objs)
+	if pageSize > 0 && start+pageSize < end {
+		end = start + pageSize
+	}
+	it.items = append(it.items, it.objs[start:end]...)
+	if end == len(it.objs) || end == start {
+		return "", nil
+	}
+	if it.versions {
+		return versionToken(it.objs[end-1]), nil
+	}
+	return listingKey(it.objs[end-1]), nil
+}
+
+func (it *sliceIterator) Next() (*storage.ObjectAttrs, error) {
+	if err := it.nextFunc(); err != nil {
+		return nil, err
+	}
+	attrs := it.items[0]
+	it.items = it.items[1:]
+	return attrs, nil
+}
+
+func (it *sliceIterator) PageInfo() *iterator.PageInfo {
+	return it.pageInfo
+}
+
+// NewErrorIterator returns an iterator failing with err, for Backend
+// implementations whose listing fails before it starts
+func NewErrorIterator(err error) ObjectIterator {
+	return newSliceIterator(nil, err)
+}
+
+// NewSliceIterator returns an iterator over objs filtered by q the way cloud storage
+// applies Prefix, StartOffset, EndOffset and Delimiter. It helps Backend
+// implementations that can list all their objects at once.
+func NewSliceIterator(objs []*storage.ObjectAttrs, q *storage.Query) ObjectIterator {
+	if q == nil {
+		q = &storage.Query{}
+	}
+	sorted := make([]*storage.ObjectAttrs, len(objs))
+	copy(sorted, objs)
+	// generations of an object listed with q.Versions are oldest first
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Generation < sorted[j].Generation
+	})
+
+	result := []*storage.ObjectAttrs{}
+	seenPrefix := map[string]bool{}
+	for _, attrs := range sorted {
+		name := attrs.Name
+		if !strings.HasPrefix(name, q.Prefix) {
+			continue
+		}
+		if q.StartOffset != "" && name < q.StartOffset {
+			continue
+		}
+		if q.EndOffset != "" && name >= q.EndOffset {
+			continue
+		}
+		if q.Delimiter != "" {
+			rest := name[len(q.Prefix):]
+			if i := strings.Index(rest, q.Delimiter); i >= 0 {
+				prefix := q.Prefix + rest[:i+len(q.Delimiter)]
+				if !seenPrefix[prefix] {
+					seenPrefix[prefix] = true
+					result = append(result, &storage.ObjectAttrs{Prefix: prefix})
+				}
+				if !(q.IncludeTrailingDelimiter && prefix == name) {
+					continue
+				}
+			}
+		}
+		result = append(result, attrs)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return listingKey(result[i]) < listingKey(result[j]) })
+	it := newSliceIterator(result, nil)
+	it.versions = q.Versions
+	return it
+}
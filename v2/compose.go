@@ -0,0 +1,221 @@
+package GCPStorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+// Defaults of UploadOptions
+const (
+	DefaultUploadPartSize = 32 << 20
+	DefaultUploadWorkers  = 8
+)
+
+// UploadOptions configure UploadParallel
+type UploadOptions struct {
+	// PartSize is the size of the parts uploaded in parallel, zero uses
+	// DefaultUploadPartSize. Smaller files are uploaded in one request.
+	PartSize int64
+	// Workers is the number of parallel part uploads, zero uses DefaultUploadWorkers
+	Workers int
+	// ContentType and Metadata are set on the final object
+	ContentType string
+	Metadata    map[string]string
+}
+
+// composeTempPrefix returns a unique prefix for the temporary objects of a compose into dst
+func composeTempPrefix(dst string) (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return dst + ".compose-" + hex.EncodeToString(id) + "/", nil
+}
+
+// Compose concatenates srcs into dst, more than MaxComposeSources objects
+// are composed in several rounds through temporary objects. The result has
+// no MD5, use its CRC32C to check it.
+func (b *Bucket) Compose(dst string, srcs []string) error {
+	_, err := b.ComposeCtx(context.Background(), dst, srcs, nil)
+	return err
+}
+
+// ComposeCtx is Compose with a context and attributes for dst, opts may be nil
+func (b *Bucket) ComposeCtx(ctx context.Context, dst string, srcs []string, opts *WriterOptions) (*storage.ObjectAttrs, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return nil, err
+	}
+	tmpPrefix, err := composeTempPrefix(dst)
+	if err != nil {
+		return nil, err
+	}
+	var temps []string
+	attrs, err := composeAll(ctx, backend, bucket, dst, srcs, opts, tmpPrefix, &temps)
+	err = cleanupTemps(backend, bucket, temps, err)
+	if err != nil {
+		return nil, wrapErr("Compose", dst, err)
+	}
+	return attrs, nil
+}
+
+// composeAll composes srcs into dst by rounds of MaxComposeSources objects,
+// the intermediate objects are added to temps
+func composeAll(ctx context.Context, backend Backend, bucket, dst string, srcs []string, opts *WriterOptions, tmpPrefix string, temps *[]string) (*storage.ObjectAttrs, error) {
+	if len(srcs) == 0 {
+		return nil, errComposeSources
+	}
+	for round := 0; len(srcs) > MaxComposeSources; round++ {
+		next := []string{}
+		for i := 0; i < len(srcs); i += MaxComposeSources {
+			end := i + MaxComposeSources
+			if end > len(srcs) {
+				end = len(srcs)
+			}
+			name := fmt.Sprintf("%scompose-%d-%05d", tmpPrefix, round, len(next))
+			*temps = append(*temps, name)
+			if _, err := backend.Compose(ctx, bucket, name, srcs[i:end], nil); err != nil {
+				return nil, err
+			}
+			next = append(next, name)
+		}
+		srcs = next
+	}
+	return backend.Compose(ctx, bucket, dst, srcs, opts)
+}
+
+// cleanupTemps deletes temporary objects even when ctx was cancelled, err is
+// the result of the operation and is returned first
+func cleanupTemps(backend Backend, bucket string, temps []string, err error) error {
+	for _, name := range temps {
+		delErr := backend.Delete(context.Background(), bucket, name, nil)
+		if err == nil && delErr != nil && !errors.Is(delErr, storage.ErrObjectNotExist) {
+			err = delErr
+		}
+	}
+	return err
+}
+
+// UploadParallel uploads localFile to dst in parts of opts.PartSize uploaded
+// in parallel as temporary objects, then composed into dst. Temporary
+// objects are deleted whether the upload succeeds or not. The CRC32C of the
+// file is computed during the upload, a composed object which does not
+// match it is deleted and ErrChecksumMismatch is returned.
+func (b *Bucket) UploadParallel(localFile, dst string, opts UploadOptions) error {
+	return b.UploadParallelCtx(context.Background(), localFile, dst, opts)
+}
+
+// UploadParallelCtx is UploadParallel with a context
+func (b *Bucket) UploadParallelCtx(ctx context.Context, localFile, dst string, opts UploadOptions) error {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return err
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = DefaultUploadPartSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultUploadWorkers
+	}
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	writerOpts := &WriterOptions{ContentType: opts.ContentType, Metadata: opts.Metadata}
+	if info.Size() <= opts.PartSize {
+		_, err := writeObject(ctx, backend, bucket, dst, io.NewSectionReader(file, 0, info.Size()), writerOpts)
+		return wrapErr("UploadParallel", dst, err)
+	}
+
+	tmpPrefix, err := composeTempPrefix(dst)
+	if err != nil {
+		return err
+	}
+	parts := []string{}
+	for offset := int64(0); offset < info.Size(); offset += opts.PartSize {
+		parts = append(parts, fmt.Sprintf("%spart-%05d", tmpPrefix, len(parts)))
+	}
+	temps := append([]string(nil), parts...)
+
+	partsCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// the file is read once more in sequence for its CRC32C
+	crc := crc32.New(crc32cTable)
+	crcDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(crc, io.NewSectionReader(file, 0, info.Size()))
+		crcDone <- err
+	}()
+	var mu sync.Mutex
+	var firstErr error
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range jobs {
+				offset := int64(part) * opts.PartSize
+				section := io.NewSectionReader(file, offset, opts.PartSize)
+				if err := uploadSection(partsCtx, backend, bucket, parts[part], section, nil); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for part := range parts {
+		if partsCtx.Err() != nil {
+			break
+		}
+		jobs <- part
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = partsCtx.Err()
+	}
+	if err := <-crcDone; firstErr == nil {
+		firstErr = err
+	}
+	if firstErr == nil {
+		var attrs *storage.ObjectAttrs
+		attrs, firstErr = composeAll(ctx, backend, bucket, dst, parts, writerOpts, tmpPrefix, &temps)
+		if firstErr == nil && attrs.CRC32C != crc.Sum32() {
+			backend.Delete(ctx, bucket, dst, &Conditions{GenerationMatch: attrs.Generation})
+			firstErr = fmt.Errorf("%w: local crc32c %08x, remote crc32c %08x", ErrChecksumMismatch, crc.Sum32(), attrs.CRC32C)
+		}
+	}
+	return wrapErr("UploadParallel", dst, cleanupTemps(backend, bucket, temps, firstErr))
+}
+
+// uploadSection writes reader to object, the object is not committed if the copy fails
+func uploadSection(ctx context.Context, backend Backend, bucket, object string, reader io.Reader, opts *WriterOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := backend.NewWriter(ctx, bucket, object, opts)
+	if _, err := io.Copy(w, reader); err != nil {
+		cancel()
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,101 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+func writeTempFile(t *testing.T, content []byte) string {
+	path := filepath.Join(t.TempDir(), "upload.bin")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUploadParallel(t *testing.T) {
+	bucket := newLocalBucket(t)
+	// 70 parts need two rounds of compose
+	content := bytes.Repeat([]byte("0123456789"), 7000)
+	err := bucket.UploadParallel(writeTempFile(t, content), "big.bin", UploadOptions{
+		PartSize:    1000,
+		Workers:     4,
+		ContentType: "application/octet-stream",
+		Metadata:    map[string]string{"k": "v"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := bucket.GetFileReader("big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("uploaded content does not match")
+	}
+	attrs, err := bucket.Attrs("big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.ContentType != "application/octet-stream" || attrs.Metadata["k"] != "v" {
+		t.Errorf("unexpected attributes: %v %v", attrs.ContentType, attrs.Metadata)
+	}
+	files, err := bucket.List("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expecting temporary parts to be deleted, got: %v", files)
+	}
+}
+
+// failingComposeBackend fails every compose
+type failingComposeBackend struct {
+	Backend
+}
+
+func (f *failingComposeBackend) Compose(ctx context.Context, bucket, dst string, srcs []string, opts *WriterOptions) (*storage.ObjectAttrs, error) {
+	return nil, errors.New("compose failed")
+}
+
+func TestUploadParallelCleanup(t *testing.T) {
+	bucket := NewBucketWithBackend("local", &failingComposeBackend{Backend: getLocalBackend(t)})
+	content := bytes.Repeat([]byte("x"), 5000)
+	err := bucket.UploadParallel(writeTempFile(t, content), "big.bin", UploadOptions{PartSize: 1000})
+	if err == nil {
+		t.Fatal("expecting the compose failure")
+	}
+	files, err := bucket.List("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expecting no objects left, got: %v", files)
+	}
+}
+
+func TestUploadParallelChecksumMismatch(t *testing.T) {
+	bucket := NewBucketWithBackend("local", &corruptingBackend{Backend: getLocalBackend(t)})
+	content := bytes.Repeat([]byte("x"), 5000)
+	err := bucket.UploadParallel(writeTempFile(t, content), "big.bin", UploadOptions{PartSize: 1000})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expecting ErrChecksumMismatch, got: %v", err)
+	}
+	files, err := bucket.List("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expecting the corrupted object to be deleted, got: %v", files)
+	}
+}
@@ -0,0 +1,112 @@
+package GCPStorage
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// DirEntry is a file or a folder of ListDir, Name is the full object name and
+// folders are the common prefixes ending with "/", their Attrs is nil
+type DirEntry struct {
+	Name  string
+	IsDir bool
+	Attrs *storage.ObjectAttrs
+}
+
+// WalkFunc is called by Walk for every folder and file, see filepath.WalkDir.
+// Returning fs.SkipDir for a folder skips its content, for a file it skips
+// the remaining entries of the folder.
+type WalkFunc func(entry DirEntry, err error) error
+
+// dirPrefix makes prefix a folder name, the empty prefix is the bucket root
+func dirPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// ListDir returns the files and sub-folders directly under the folder prefix,
+// sorted by name. A placeholder object named like the folder is not listed.
+func (b *Bucket) ListDir(prefix string, optionalBucket ...string) ([]DirEntry, error) {
+	return b.ListDirCtx(context.Background(), prefix, optionalBucket...)
+}
+
+// ListDirCtx is ListDir with a context
+func (b *Bucket) ListDirCtx(ctx context.Context, prefix string, optionalBucket ...string) ([]DirEntry, error) {
+	prefix = dirPrefix(prefix)
+	entries := []DirEntry{}
+	it := b.Objects(ctx, Query{Prefix: prefix, Delimiter: "/"}, optionalBucket...)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case attrs.Prefix != "":
+			entries = append(entries, DirEntry{Name: attrs.Prefix, IsDir: true})
+		case attrs.Name != prefix:
+			entries = append(entries, DirEntry{Name: attrs.Name, Attrs: attrs})
+		}
+	}
+	return entries, nil
+}
+
+// Walk visits the folder tree under prefix, starting with the folder itself
+func (b *Bucket) Walk(prefix string, fn WalkFunc, optionalBucket ...string) error {
+	return b.WalkCtx(context.Background(), prefix, fn, optionalBucket...)
+}
+
+// WalkCtx is Walk with a context
+func (b *Bucket) WalkCtx(ctx context.Context, prefix string, fn WalkFunc, optionalBucket ...string) error {
+	root := DirEntry{Name: dirPrefix(prefix), IsDir: true}
+	err := fn(root, nil)
+	if err == nil {
+		err = b.walk(ctx, root, fn, optionalBucket)
+	}
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walk visits the content of dir, fn was already called for dir
+func (b *Bucket) walk(ctx context.Context, dir DirEntry, fn WalkFunc, optionalBucket []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := b.ListDirCtx(ctx, dir.Name, optionalBucket...)
+	if err != nil {
+		// fn is called a second time for dir with the error, fs.SkipDir
+		// skips dir and the walk continues with its siblings
+		if err := fn(dir, err); err != fs.SkipDir {
+			return err
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		err := fn(entry, nil)
+		if err == fs.SkipDir {
+			if entry.IsDir {
+				continue
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir {
+			if err := b.walk(ctx, entry, fn, optionalBucket); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
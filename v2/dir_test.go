@@ -0,0 +1,94 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+func putTree(t *testing.T, bucket *Bucket) {
+	for _, name := range []string{"root.txt", "dir/", "dir/a.txt", "dir/sub/b.txt", "dir/skip/c.txt", "dir/z.txt"} {
+		putString(t, bucket, name, name)
+	}
+}
+
+func TestListDir(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putTree(t, bucket)
+	entries, err := bucket.ListDir("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, entry := range entries {
+		if entry.IsDir != strings.HasSuffix(entry.Name, "/") {
+			t.Errorf("unexpected IsDir %v for %v", entry.IsDir, entry.Name)
+		}
+		got = append(got, entry.Name)
+	}
+	want := "dir/a.txt,dir/skip/,dir/sub/,dir/z.txt"
+	if strings.Join(got, ",") != want {
+		t.Errorf("expecting %v, got: %v", want, got)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putTree(t, bucket)
+	got := []string{}
+	err := bucket.Walk("", func(entry DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, entry.Name)
+		if entry.Name == "dir/skip/" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ",dir/,dir/a.txt,dir/skip/,dir/sub/,dir/sub/b.txt,dir/z.txt,root.txt"
+	if strings.Join(got, ",") != want {
+		t.Errorf("expecting %v, got: %v", want, strings.Join(got, ","))
+	}
+}
+
+// failingDirBackend fails the listings of the folder dir
+type failingDirBackend struct {
+	Backend
+	dir string
+}
+
+func (f *failingDirBackend) Objects(ctx context.Context, bucket string, q *storage.Query) ObjectIterator {
+	if q.Prefix == f.dir {
+		return NewErrorIterator(errors.New("list failed"))
+	}
+	return f.Backend.Objects(ctx, bucket, q)
+}
+
+func TestWalkSkipFailingDir(t *testing.T) {
+	bucket := NewBucketWithBackend("local", &failingDirBackend{Backend: getLocalBackend(t), dir: "dir/skip/"})
+	putTree(t, bucket)
+	got := []string{}
+	err := bucket.Walk("", func(entry DirEntry, err error) error {
+		if err != nil {
+			got = append(got, "error "+entry.Name)
+			return fs.SkipDir
+		}
+		got = append(got, entry.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ",dir/,dir/a.txt,dir/skip/,error dir/skip/,dir/sub/,dir/sub/b.txt,dir/z.txt,root.txt"
+	if strings.Join(got, ",") != want {
+		t.Errorf("expecting %v, got: %v", want, strings.Join(got, ","))
+	}
+}
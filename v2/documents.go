@@ -0,0 +1,169 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"time"
+)
+
+// AnyGeneration is the ifGeneration of Documents.Put and Documents.Delete
+// which replaces or deletes whatever generation is stored
+const AnyGeneration int64 = -1
+
+// DefaultDocumentRetries is the number of conflicts UpdateDocument retries by default
+const DefaultDocumentRetries = 10
+
+// maxDocumentBackoff caps the wait between two attempts of UpdateDocument
+const maxDocumentBackoff = time.Second
+
+// Documents stores JSON documents as objects under a folder of a bucket.
+// Every document has a generation, writes conditioned on the generation that
+// was read make concurrent updates from several processes safe.
+type Documents struct {
+	bucket *Bucket
+	prefix string
+	// MaxRetries is the number of conflicts UpdateDocument retries before returning
+	// ErrPreconditionFailed
+	MaxRetries int
+}
+
+// Documents returns the documents stored under the folder prefix, the empty
+// prefix is the whole bucket
+func (b *Bucket) Documents(prefix string) *Documents {
+	return &Documents{bucket: b, prefix: dirPrefix(prefix), MaxRetries: DefaultDocumentRetries}
+}
+
+// generationConditions turns ifGeneration into conditions, 0 requires that
+// the document does not exist
+func generationConditions(ifGeneration int64) *Conditions {
+	switch {
+	case ifGeneration == AnyGeneration:
+		return nil
+	case ifGeneration == 0:
+		return &Conditions{DoesNotExist: true}
+	default:
+		return &Conditions{GenerationMatch: ifGeneration}
+	}
+}
+
+// Get unmarshals the document key into v and returns its generation, a
+// missing document is ErrNotExist
+func (d *Documents) Get(key string, v interface{}) (int64, error) {
+	return d.GetCtx(context.Background(), key, v)
+}
+
+// GetCtx is Get with a context
+func (d *Documents) GetCtx(ctx context.Context, key string, v interface{}) (int64, error) {
+	backend, bucket, err := d.bucket.use()
+	if err != nil {
+		return 0, err
+	}
+	object := d.prefix + key
+	reader, attrs, err := openObject(ctx, backend, bucket, object)
+	if err != nil {
+		return 0, wrapErr("Get", object, err)
+	}
+	defer reader.Close()
+	// the read is pinned to attrs.Generation and checked against its CRC32C
+	data, err := ioutil.ReadAll(newChecksumReader(reader, attrs))
+	if err != nil {
+		return 0, wrapErr("Get", object, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return 0, err
+	}
+	return attrs.Generation, nil
+}
+
+// Put stores v as the document key if its generation is ifGeneration and
+// returns the new generation. ifGeneration 0 creates the document only if it
+// does not exist, AnyGeneration always writes. A document changed since
+// ifGeneration is not written and the error is ErrPreconditionFailed.
+func (d *Documents) Put(key string, v interface{}, ifGeneration int64) (int64, error) {
+	return d.PutCtx(context.Background(), key, v, ifGeneration)
+}
+
+// PutCtx is Put with a context
+func (d *Documents) PutCtx(ctx context.Context, key string, v interface{}, ifGeneration int64) (int64, error) {
+	backend, bucket, err := d.bucket.use()
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	object := d.prefix + key
+	attrs, err := writeObject(ctx, backend, bucket, object, bytes.NewReader(data), &WriterOptions{
+		ContentType: "application/json",
+		Conditions:  generationConditions(ifGeneration),
+	})
+	if err != nil {
+		return 0, wrapErr("Put", object, err)
+	}
+	return attrs.Generation, nil
+}
+
+// Delete removes the document key if its generation is ifGeneration,
+// AnyGeneration deletes whatever is stored
+func (d *Documents) Delete(key string, ifGeneration int64) error {
+	return d.DeleteCtx(context.Background(), key, ifGeneration)
+}
+
+// DeleteCtx is Delete with a context
+func (d *Documents) DeleteCtx(ctx context.Context, key string, ifGeneration int64) error {
+	backend, bucket, err := d.bucket.use()
+	if err != nil {
+		return err
+	}
+	if ifGeneration == 0 {
+		return fmt.Errorf("GCPStorage: cannot delete generation 0 of %q", key)
+	}
+	object := d.prefix + key
+	return wrapErr("Delete", object, backend.Delete(ctx, bucket, object, generationConditions(ifGeneration)))
+}
+
+// UpdateDocument reads the document key, calls fn to change it and writes it
+// back conditioned on the generation read. On a conflict with another
+// writer it waits and starts over with the new document, up to
+// docs.MaxRetries times. A missing document is passed to fn as the zero value
+// and created. An error from fn aborts the update and is returned as is. It
+// returns the generation written.
+func UpdateDocument[T any](docs *Documents, key string, fn func(*T) error) (int64, error) {
+	return UpdateDocumentCtx(context.Background(), docs, key, fn)
+}
+
+// UpdateDocumentCtx is UpdateDocument with a context, cancelling ctx stops
+// waiting between attempts
+func UpdateDocumentCtx[T any](ctx context.Context, docs *Documents, key string, fn func(*T) error) (int64, error) {
+	for attempt := 0; ; attempt++ {
+		var v T
+		generation, err := docs.GetCtx(ctx, key, &v)
+		if err != nil && !errors.Is(err, ErrNotExist) {
+			return 0, err
+		}
+		if err := fn(&v); err != nil {
+			return 0, err
+		}
+		generation, err = docs.PutCtx(ctx, key, &v, generation)
+		if err == nil || !errors.Is(err, ErrPreconditionFailed) || attempt >= docs.MaxRetries {
+			return generation, err
+		}
+		backoff := maxDocumentBackoff
+		if attempt < 6 {
+			backoff = time.Duration(10<<uint(attempt)) * time.Millisecond
+		}
+		timer := time.NewTimer(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2))))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
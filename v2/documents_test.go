@@ -0,0 +1,102 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type counter struct {
+	Count int `json:"count"`
+}
+
+func TestDocuments(t *testing.T) {
+	ctx := context.Background()
+	docs := newLocalBucket(t).Documents("state")
+	v := counter{}
+	if _, err := docs.Get("counter.json", &v); !errors.Is(err, ErrNotExist) {
+		t.Errorf("expecting ErrNotExist, got: %v", err)
+	}
+	generation, err := docs.PutCtx(ctx, "counter.json", counter{Count: 1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := docs.PutCtx(ctx, "counter.json", counter{Count: 2}, 0); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed creating the document twice, got: %v", err)
+	}
+	read, err := docs.GetCtx(ctx, "counter.json", &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != generation || v.Count != 1 {
+		t.Errorf("expecting count 1 at generation %v, got: %+v at %v", generation, v, read)
+	}
+	if _, err := docs.PutCtx(ctx, "counter.json", counter{Count: 2}, generation); err != nil {
+		t.Fatal(err)
+	}
+	if err := docs.DeleteCtx(ctx, "counter.json", generation); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed deleting a stale generation, got: %v", err)
+	}
+	if err := docs.Delete("counter.json", AnyGeneration); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateDocument(t *testing.T) {
+	ctx := context.Background()
+	docs := newLocalBucket(t).Documents("state")
+	docs.MaxRetries = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 4; j++ {
+				_, err := UpdateDocumentCtx(ctx, docs, "counter.json", func(c *counter) error {
+					c.Count++
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	v := counter{}
+	if _, err := docs.GetCtx(ctx, "counter.json", &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Count != 20 {
+		t.Errorf("expecting 20 increments, got: %v", v.Count)
+	}
+	abort := errors.New("abort")
+	_, err := UpdateDocument(docs, "counter.json", func(c *counter) error { return abort })
+	if err != abort {
+		t.Errorf("expecting the error of fn, got: %v", err)
+	}
+}
+
+func TestDocumentsGetReplaced(t *testing.T) {
+	ctx := context.Background()
+	backend := &replacingBackend{LocalFSBackend: getLocalBackend(t), object: "state/counter.json", data: `{"count": 2}`, replaced: true}
+	docs := NewBucketWithBackend("local", backend).Documents("state")
+	if _, err := docs.PutCtx(ctx, "counter.json", counter{Count: 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// the document is replaced between its attributes and its read
+	backend.replaced = false
+	v := counter{}
+	generation, err := docs.GetCtx(ctx, "counter.json", &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := backend.Attrs(ctx, "local", "state/counter.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Count != 2 || generation != attrs.Generation {
+		t.Errorf("expecting count 2 at generation %v, got: %+v at %v", attrs.Generation, v, generation)
+	}
+}
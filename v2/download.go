@@ -0,0 +1,230 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// Defaults of DownloadOptions
+const (
+	DefaultDownloadPartSize = 32 << 20
+	DefaultDownloadWorkers  = 8
+)
+
+// DownloadOptions configure DownloadParallel
+type DownloadOptions struct {
+	// PartSize is the size of the ranges read in parallel, zero uses DefaultDownloadPartSize
+	PartSize int64
+	// Workers is the number of parallel range reads, zero uses DefaultDownloadWorkers
+	Workers int
+	// StatePath is the file recording the downloaded parts, it defaults to
+	// dst + ".download" and is removed when the download completes
+	StatePath string
+}
+
+// downloadState is the content of the state file of a parallel download
+type downloadState struct {
+	Bucket     string `json:"bucket"`
+	Object     string `json:"object"`
+	Generation int64  `json:"generation"`
+	Size       int64  `json:"size"`
+	PartSize   int64  `json:"partSize"`
+	Done       []bool `json:"done"`
+}
+
+// matches reports whether a previous download of the same object generation can be resumed
+func (s *downloadState) matches(o *downloadState) bool {
+	return s.Bucket == o.Bucket && s.Object == o.Object && s.Generation == o.Generation &&
+		s.Size == o.Size && s.PartSize == o.PartSize && len(s.Done) == len(o.Done)
+}
+
+// offsetWriter writes sequentially into f starting at offset
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// DownloadParallel downloads src to the local file dst reading ranges of
+// the object in parallel. The whole file is checked against the CRC32C and
+// MD5 of the object. An interrupted download keeps its state file and the
+// next call for the same object generation only fetches the missing parts.
+// Every part is read from the generation recorded in the state, a download
+// whose generation was replaced fails with ErrNotExist and starts over.
+// A download failing the checks is removed. Objects stored with gzip
+// content encoding are served decompressed, their ranges cannot be read and
+// they are downloaded with Download.
+func (b *Bucket) DownloadParallel(src, dst string, opts DownloadOptions) error {
+	return b.DownloadParallelCtx(context.Background(), src, dst, opts)
+}
+
+// DownloadParallelCtx is DownloadParallel with a context, cancelling ctx stops
+// the transfer and keeps the state for a later resume
+func (b *Bucket) DownloadParallelCtx(ctx context.Context, src, dst string, opts DownloadOptions) error {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return err
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = DefaultDownloadPartSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultDownloadWorkers
+	}
+	if opts.StatePath == "" {
+		opts.StatePath = dst + ".download"
+	}
+	attrs, err := backend.Attrs(ctx, bucket, src)
+	if err != nil {
+		return wrapErr("DownloadParallel", src, err)
+	}
+	if attrs.ContentEncoding == "gzip" {
+		return b.DownloadCtx(ctx, src, dst)
+	}
+	parts := (attrs.Size + opts.PartSize - 1) / opts.PartSize
+	state := &downloadState{
+		Bucket:     bucket,
+		Object:     src,
+		Generation: attrs.Generation,
+		Size:       attrs.Size,
+		PartSize:   opts.PartSize,
+		Done:       make([]bool, parts),
+	}
+	flags := os.O_RDWR | os.O_CREATE
+	prev := &downloadState{}
+	if _, err := os.Stat(dst); err == nil && loadState(opts.StatePath, prev) && prev.matches(state) {
+		state = prev
+	} else {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(dst, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Truncate(attrs.Size); err != nil {
+		return err
+	}
+	if err := saveState(opts.StatePath, state); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	jobs := make(chan int64)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range jobs {
+				offset := part * opts.PartSize
+				length := opts.PartSize
+				if offset+length > attrs.Size {
+					length = attrs.Size - offset
+				}
+				if err := downloadPart(ctx, backend, bucket, src, attrs.Generation, file, offset, length); err != nil {
+					fail(err)
+					continue
+				}
+				mu.Lock()
+				state.Done[part] = true
+				err := saveState(opts.StatePath, state)
+				mu.Unlock()
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+	for part := int64(0); part < parts; part++ {
+		if state.Done[part] {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- part
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		err := wrapErr("DownloadParallel", src, firstErr)
+		if errors.Is(err, ErrNotExist) {
+			// the generation is gone, its parts cannot be resumed
+			os.Remove(opts.StatePath)
+		}
+		return err
+	}
+
+	if err := verifyFile(file, attrs.CRC32C, attrs.MD5); err != nil {
+		// the parts on disk are not trustworthy, the next call starts over
+		file.Close()
+		os.Remove(dst)
+		os.Remove(opts.StatePath)
+		return &Error{Op: "DownloadParallel", Object: src, Kind: ErrChecksumMismatch, Err: err}
+	}
+	return os.Remove(opts.StatePath)
+}
+
+// downloadPart copies length bytes of generation of object at offset into file
+func downloadPart(ctx context.Context, backend Backend, bucket, object string, generation int64, file *os.File, offset, length int64) error {
+	reader, err := newGenerationReader(ctx, backend, bucket, object, generation, offset, length)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	n, err := io.Copy(&offsetWriter{f: file, offset: offset}, reader)
+	if err != nil {
+		return err
+	}
+	if n != length {
+		return fmt.Errorf("read %d bytes at offset %d, expecting %d", n, offset, length)
+	}
+	return nil
+}
+
+// verifyFile checks the content of file against the checksums of an object,
+// an empty md5 is not checked, composite objects have none
+func verifyFile(file *os.File, crc uint32, md5sum []byte) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	crcHash := crc32.New(crc32cTable)
+	md5Hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(crcHash, md5Hash), file); err != nil {
+		return err
+	}
+	if crcHash.Sum32() != crc {
+		return fmt.Errorf("%w: local crc32c %08x, remote crc32c %08x", ErrChecksumMismatch, crcHash.Sum32(), crc)
+	}
+	if len(md5sum) > 0 && !bytes.Equal(md5Hash.Sum(nil), md5sum) {
+		return fmt.Errorf("%w: local md5 %x, remote md5 %x", ErrChecksumMismatch, md5Hash.Sum(nil), md5sum)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+// rangeCountingBackend counts range reads and fails the one at failOffset
+type rangeCountingBackend struct {
+	Backend
+	mu         sync.Mutex
+	reads      int
+	failOffset int64
+}
+
+func (r *rangeCountingBackend) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, error) {
+	r.mu.Lock()
+	r.reads++
+	fail := offset == r.failOffset
+	r.mu.Unlock()
+	if fail {
+		return nil, errors.New("range read failed")
+	}
+	return r.Backend.NewRangeReader(ctx, bucket, object, offset, length)
+}
+
+func TestDownloadParallelResume(t *testing.T) {
+	backend := &rangeCountingBackend{Backend: getLocalBackend(t), failOffset: 5000}
+	bucket := NewBucketWithBackend("local", backend)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	if err := bucket.UploadFromReader(bytes.NewReader(content), "big.bin"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "big.bin")
+	opts := DownloadOptions{PartSize: 1000, Workers: 1}
+
+	err := bucket.DownloadParallel("big.bin", dst, opts)
+	if err == nil {
+		t.Fatal("expecting the failing range read to fail the download")
+	}
+	if _, err := os.Stat(dst + ".download"); err != nil {
+		t.Fatalf("expecting a state file, got: %v", err)
+	}
+
+	backend.failOffset = -1
+	backend.reads = 0
+	if err := bucket.DownloadParallel("big.bin", dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	// parts before the failing one were kept
+	if backend.reads != 11 {
+		t.Errorf("expecting 11 range reads on resume, got: %v", backend.reads)
+	}
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("downloaded content does not match")
+	}
+	if _, err := os.Stat(dst + ".download"); !os.IsNotExist(err) {
+		t.Errorf("expecting the state file to be removed, got: %v", err)
+	}
+}
+
+func TestDownloadParallel(t *testing.T) {
+	bucket := newLocalBucket(t)
+	content := bytes.Repeat([]byte("parallel"), 4321)
+	if err := bucket.UploadFromReader(bytes.NewReader(content), "file.bin"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "file.bin")
+	if err := bucket.DownloadParallel("file.bin", dst, DownloadOptions{PartSize: 1024, Workers: 4}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("downloaded content does not match")
+	}
+}
+
+// replacingReadBackend replaces object before the range read at offset
+type replacingReadBackend struct {
+	*LocalFSBackend
+	offset int64
+}
+
+func (r *replacingReadBackend) NewGenerationReader(ctx context.Context, bucket, object string, generation, offset, length int64) (io.ReadCloser, error) {
+	if offset == r.offset {
+		writeObject(ctx, r.LocalFSBackend, bucket, object, bytes.NewReader([]byte("replaced")), nil)
+	}
+	return r.LocalFSBackend.NewGenerationReader(ctx, bucket, object, generation, offset, length)
+}
+
+func TestDownloadParallelReplaced(t *testing.T) {
+	bucket := NewBucketWithBackend("local", &replacingReadBackend{LocalFSBackend: getLocalBackend(t), offset: 3000})
+	if err := bucket.UploadFromReader(bytes.NewReader(bytes.Repeat([]byte("0123456789"), 500)), "big.bin"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "big.bin")
+	err := bucket.DownloadParallel("big.bin", dst, DownloadOptions{PartSize: 1000, Workers: 1})
+	if !errors.Is(err, ErrNotExist) {
+		t.Fatalf("expecting ErrNotExist, got: %v", err)
+	}
+	if _, err := os.Stat(dst + ".download"); !os.IsNotExist(err) {
+		t.Errorf("expecting the state file to be removed, got: %v", err)
+	}
+}
+
+func TestDownloadParallelChecksumMismatch(t *testing.T) {
+	bucket := NewBucketWithBackend("local", &corruptReadBackend{Backend: getLocalBackend(t)})
+	if err := bucket.UploadFromReader(bytes.NewReader(bytes.Repeat([]byte("0123456789"), 500)), "big.bin"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "big.bin")
+	err := bucket.DownloadParallel("big.bin", dst, DownloadOptions{PartSize: 1000})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expecting ErrChecksumMismatch, got: %v", err)
+	}
+	for _, path := range []string{dst, dst + ".download"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expecting %s to be removed, got: %v", path, err)
+		}
+	}
+}
+
+// gzipBackend reports every object as stored with gzip content encoding
+type gzipBackend struct {
+	rangeCountingBackend
+}
+
+func (g *gzipBackend) Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error) {
+	attrs, err := g.Backend.Attrs(ctx, bucket, object)
+	if attrs != nil {
+		attrs.ContentEncoding = "gzip"
+	}
+	return attrs, err
+}
+
+func TestDownloadParallelGzip(t *testing.T) {
+	backend := &gzipBackend{rangeCountingBackend{Backend: getLocalBackend(t), failOffset: -1}}
+	bucket := NewBucketWithBackend("local", backend)
+	content := bytes.Repeat([]byte("compressed"), 500)
+	if err := bucket.UploadFromReader(bytes.NewReader(content), "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "file.txt")
+	if err := bucket.DownloadParallel("file.txt", dst, DownloadOptions{PartSize: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if backend.reads != 1 {
+		t.Errorf("expecting a single read of the whole object, got: %v", backend.reads)
+	}
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("downloaded content does not match")
+	}
+	if _, err := os.Stat(dst + ".download"); !os.IsNotExist(err) {
+		t.Errorf("expecting no state file, got: %v", err)
+	}
+}
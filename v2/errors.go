@@ -0,0 +1,159 @@
+package GCPStorage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// Errors reported by Bucket methods, test for them with errors.Is
+var (
+	// ErrNotExist means the object or the bucket does not exist
+	ErrNotExist = errors.New("GCPStorage: object does not exist")
+	// ErrChecksumMismatch means the data read or written does not match its checksum
+	ErrChecksumMismatch = errors.New("GCPStorage: checksum mismatch")
+	// ErrPreconditionFailed means a generation or existence condition was not met
+	ErrPreconditionFailed = errors.New("GCPStorage: precondition failed")
+	// ErrPermissionDenied means the credentials do not allow the operation
+	ErrPermissionDenied = errors.New("GCPStorage: permission denied")
+	// ErrNoMD5 means the object has no MD5, composite objects only have a CRC32C
+	ErrNoMD5 = errors.New("GCPStorage: object has no md5")
+)
+
+// Error is a failed Bucket operation, Kind is one of the Err values of the
+// package. Err is the underlying storage error so errors.Is(err,
+// storage.ErrObjectNotExist) and errors.As(err, &googleapi.Error{}) keep working.
+type Error struct {
+	Op     string
+	Object string
+	Kind   error
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Op + " " + e.Object + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the Kind of e
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// errorKind classifies storage, googleapi and file system errors
+func errorKind(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist), errors.Is(err, storage.ErrBucketNotExist):
+		return ErrNotExist
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermissionDenied
+	}
+	for _, kind := range []error{ErrNotExist, ErrChecksumMismatch, ErrPreconditionFailed, ErrPermissionDenied} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	apiErr := &googleapi.Error{}
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusNotFound:
+			return ErrNotExist
+		case http.StatusPreconditionFailed:
+			return ErrPreconditionFailed
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ErrPermissionDenied
+		case http.StatusBadRequest:
+			// uploads whose data does not match the checksum sent along are rejected
+			if strings.Contains(strings.ToLower(apiErr.Message), "crc32c") {
+				return ErrChecksumMismatch
+			}
+		}
+	}
+	return nil
+}
+
+// wrapErr turns errors errorKind knows into an *Error of op on object, other errors are returned as is
+func wrapErr(op, object string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if e := (*Error)(nil); errors.As(err, &e) {
+		return err
+	}
+	kind := errorKind(err)
+	if kind == nil {
+		return err
+	}
+	return &Error{Op: op, Object: object, Kind: kind, Err: err}
+}
+
+// ObjectError is the failure of an operation on a single object
+type ObjectError struct {
+	Object string
+	Err    error
+}
+
+func (e *ObjectError) Error() string {
+	return e.Object + ": " + e.Err.Error()
+}
+
+func (e *ObjectError) Unwrap() error {
+	return e.Err
+}
+
+// FolderError collects the failures of an operation over a folder, usually
+// one *ObjectError per failed object. errors.Is and errors.As look into every
+// error, its Is and As methods do so before Go 1.20.
+type FolderError struct {
+	Op     string
+	Errors []error
+}
+
+func (e *FolderError) Error() string {
+	lines := make([]string, 0, len(e.Errors)+1)
+	lines = append(lines, fmt.Sprintf("%s: %d errors", e.Op, len(e.Errors)))
+	for _, err := range e.Errors {
+		lines = append(lines, "\t"+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *FolderError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether any of the errors matches target
+func (e *FolderError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target
+func (e *FolderError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// errOrNil returns e when it holds errors and nil otherwise
+func (e *FolderError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
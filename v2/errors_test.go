@@ -0,0 +1,223 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+func TestWrapErr(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{storage.ErrObjectNotExist, ErrNotExist},
+		{&googleapi.Error{Code: http.StatusNotFound}, ErrNotExist},
+		{&googleapi.Error{Code: http.StatusPreconditionFailed}, ErrPreconditionFailed},
+		{&googleapi.Error{Code: http.StatusForbidden}, ErrPermissionDenied},
+		{&googleapi.Error{Code: http.StatusBadRequest, Message: "Provided CRC32C \"AAAAAA==\" doesn't match calculated CRC32C \"n5mIuQ==\"."}, ErrChecksumMismatch},
+	}
+	for _, test := range tests {
+		err := wrapErr("Attrs", "file.txt", test.err)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("expecting %v to be %v", err, test.kind)
+		}
+		if !errors.Is(err, test.err) && !errors.As(err, new(*googleapi.Error)) {
+			t.Errorf("expecting %v to wrap %v", err, test.err)
+		}
+	}
+	if err := wrapErr("Attrs", "file.txt", context.Canceled); err != context.Canceled {
+		t.Errorf("expecting unknown errors to be returned as is, got: %v", err)
+	}
+}
+
+func TestFolderError(t *testing.T) {
+	err := &FolderError{Op: "DeleteFolder", Errors: []error{
+		errors.New("failed"),
+		&ObjectError{Object: "a.txt", Err: wrapErr("Delete", "a.txt", storage.ErrObjectNotExist)},
+	}}
+	// the methods are what errors.Is and errors.As use before Go 1.20
+	if !err.Is(ErrNotExist) || err.Is(ErrPermissionDenied) {
+		t.Errorf("expecting only ErrNotExist in %v", err)
+	}
+	objErr := &ObjectError{}
+	if !err.As(&objErr) || objErr.Object != "a.txt" {
+		t.Errorf("expecting the ObjectError of a.txt, got: %v", objErr)
+	}
+	if !errors.Is(err, ErrNotExist) {
+		t.Errorf("expecting errors.Is to find ErrNotExist in %v", err)
+	}
+}
+
+func TestExistsMissing(t *testing.T) {
+	bucket := getBucket(t)
+	exists, err := bucket.Exists("missing.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("missing.txt should not exist")
+	}
+}
+
+// corruptingBackend flips the first byte of every object written
+type corruptingBackend struct {
+	Backend
+}
+
+type corruptingWriter struct {
+	ObjectWriter
+	written bool
+}
+
+func (c *corruptingBackend) NewWriter(ctx context.Context, bucket, object string, opts *WriterOptions) ObjectWriter {
+	return &corruptingWriter{ObjectWriter: c.Backend.NewWriter(ctx, bucket, object, opts)}
+}
+
+func (w *corruptingWriter) Write(p []byte) (int, error) {
+	if !w.written && len(p) > 0 {
+		w.written = true
+		p = append([]byte{p[0] ^ 0xff}, p[1:]...)
+	}
+	return w.ObjectWriter.Write(p)
+}
+
+func TestUploadVerifyMismatch(t *testing.T) {
+	bucket := NewBucketWithBackend("test-bucket", &corruptingBackend{Backend: getLocalBackend(t)})
+	err := bucket.UploadVerify("testFiles/localfile.txt", "file.txt")
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expecting ErrChecksumMismatch, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "file.txt") {
+		t.Errorf("expecting the object name in %v", err)
+	}
+}
+
+func TestUploadFromReaderMismatch(t *testing.T) {
+	bucket := NewBucketWithBackend("test-bucket", &corruptingBackend{Backend: getLocalBackend(t)})
+	err := bucket.UploadFromReader(strings.NewReader("data"), "file.txt")
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expecting ErrChecksumMismatch, got: %v", err)
+	}
+	if exists, err := bucket.Exists("file.txt"); err != nil || exists {
+		t.Errorf("expecting the corrupted object to be deleted, got: %v %v", exists, err)
+	}
+}
+
+// corruptReadBackend flips the first byte of every read
+type corruptReadBackend struct {
+	Backend
+}
+
+func (c *corruptReadBackend) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := c.Backend.NewRangeReader(ctx, bucket, object, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		data[0] ^= 0xff
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	bucket := NewBucketWithBackend("test-bucket", &corruptReadBackend{Backend: getLocalBackend(t)})
+	if err := bucket.Upload("testFiles/localfile.txt", "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "file.txt")
+	err := bucket.Download("file.txt", dst)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expecting ErrChecksumMismatch, got: %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expecting the corrupted download to be removed, got: %v", err)
+	}
+}
+
+// replacingBackend writes data as a new generation of object right after
+// returning its attributes once
+type replacingBackend struct {
+	*LocalFSBackend
+	object   string
+	data     string
+	replaced bool
+}
+
+func (r *replacingBackend) Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error) {
+	attrs, err := r.LocalFSBackend.Attrs(ctx, bucket, object)
+	if object == r.object && !r.replaced {
+		r.replaced = true
+		writeObject(ctx, r.LocalFSBackend, bucket, object, strings.NewReader(r.data), nil)
+	}
+	return attrs, err
+}
+
+func TestDownloadReplaced(t *testing.T) {
+	bucket := NewBucketWithBackend("test-bucket", &replacingBackend{LocalFSBackend: getLocalBackend(t), object: "file.txt", data: "replaced"})
+	if err := bucket.Upload("testFiles/localfile.txt", "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "file.txt")
+	if err := bucket.Download("file.txt", dst); err != nil {
+		t.Fatalf("expecting the new generation to be downloaded, got: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(dst); string(data) != "replaced" {
+		t.Errorf("expecting 'replaced', got: %s", data)
+	}
+}
+
+func TestChecksumReaderGzip(t *testing.T) {
+	attrs := &storage.ObjectAttrs{Name: "file.txt.gz", ContentEncoding: "gzip", CRC32C: 1}
+	// the data is decompressed, it cannot match the CRC32C of the stored object
+	reader := newChecksumReader(ioutil.NopCloser(strings.NewReader("data")), attrs)
+	if _, err := ioutil.ReadAll(reader); err != nil {
+		t.Errorf("expecting transcoded data not to be checked, got: %v", err)
+	}
+	attrs.ContentEncoding = ""
+	reader = newChecksumReader(ioutil.NopCloser(strings.NewReader("data")), attrs)
+	if _, err := ioutil.ReadAll(reader); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expecting ErrChecksumMismatch, got: %v", err)
+	}
+}
+
+// noMD5Backend stores objects without MD5 like composite objects
+type noMD5Backend struct {
+	Backend
+}
+
+type noMD5Writer struct {
+	ObjectWriter
+}
+
+func (n *noMD5Backend) NewWriter(ctx context.Context, bucket, object string, opts *WriterOptions) ObjectWriter {
+	return &noMD5Writer{ObjectWriter: n.Backend.NewWriter(ctx, bucket, object, opts)}
+}
+
+func (w *noMD5Writer) Attrs() *storage.ObjectAttrs {
+	attrs := *w.ObjectWriter.Attrs()
+	attrs.MD5 = nil
+	return &attrs
+}
+
+func TestUploadVerifyWithoutMD5(t *testing.T) {
+	bucket := NewBucketWithBackend("test-bucket", &noMD5Backend{Backend: getLocalBackend(t)})
+	if err := bucket.UploadVerify("testFiles/localfile.txt", "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
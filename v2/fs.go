@@ -0,0 +1,266 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// FS is an fs.FS over the objects of a bucket, folders are the prefixes
+// ending with "/". It implements fs.ReadDirFS, fs.StatFS and fs.ReadFileFS
+// and its files implement io.Seeker, so it works with http.FS,
+// template.ParseFS and fs.WalkDir. It also implements WriteFS.
+type FS struct {
+	ctx    context.Context
+	bucket *Bucket
+	prefix string
+}
+
+var (
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+)
+
+// FS returns the bucket as an fs.FS rooted at the folder prefix, the empty
+// prefix is the whole bucket
+func (b *Bucket) FS(prefix string) *FS {
+	return &FS{ctx: context.Background(), bucket: b, prefix: dirPrefix(prefix)}
+}
+
+// WithContext returns a copy of fsys using ctx for its requests
+func (fsys *FS) WithContext(ctx context.Context) *FS {
+	c := *fsys
+	c.ctx = ctx
+	return &c
+}
+
+// Sub implements fs.SubFS
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return fsys, nil
+	}
+	c := *fsys
+	c.prefix = fsys.prefix + dir + "/"
+	return &c, nil
+}
+
+// object returns the object name of the fs path name
+func (fsys *FS) object(name string) string {
+	if name == "." {
+		return fsys.prefix
+	}
+	return fsys.prefix + name
+}
+
+// pathError turns the errors of the bucket into fs errors
+func pathError(op, name string, err error) error {
+	if errors.Is(err, ErrNotExist) {
+		err = fs.ErrNotExist
+	} else if errors.Is(err, ErrPermissionDenied) {
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// stat finds name as an object, or as a folder when objects exist under it
+func (fsys *FS) stat(op, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &fileInfo{name: ".", dir: true}, nil
+	}
+	attrs, err := fsys.bucket.AttrsCtx(fsys.ctx, fsys.object(name))
+	if err == nil {
+		return &fileInfo{name: path.Base(name), attrs: attrs}, nil
+	}
+	if !errors.Is(err, ErrNotExist) {
+		return nil, pathError(op, name, err)
+	}
+	it := fsys.bucket.Objects(fsys.ctx, Query{Prefix: fsys.object(name) + "/", PageSize: 1})
+	if _, err = it.Next(); err == iterator.Done {
+		err = ErrNotExist
+	}
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	return &fileInfo{name: path.Base(name), dir: true}, nil
+}
+
+// Stat implements fs.StatFS
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+// Open implements fs.FS, file content is read on first use
+func (fsys *FS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &fsDir{fsys: fsys, name: name, info: info}, nil
+	}
+	backend, bucket, err := fsys.bucket.use()
+	if err != nil {
+		return nil, err
+	}
+	fi := info.(*fileInfo)
+	return &fsFile{ObjectReader: newObjectReader(fsys.ctx, backend, bucket, fi.attrs), info: fi}, nil
+}
+
+// ReadFile implements fs.ReadFileFS
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	reader, err := fsys.bucket.newReader(fsys.ctx, fsys.object(name))
+	if err != nil {
+		return nil, pathError("read", name, err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, pathError("read", name, err)
+	}
+	return data, nil
+}
+
+// ReadDir implements fs.ReadDirFS, entries are sorted by name
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dir := dirPrefix(fsys.object(name))
+	list, err := fsys.bucket.ListDirCtx(fsys.ctx, dir)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	entries := []fs.DirEntry{}
+	for _, entry := range list {
+		base := strings.TrimSuffix(strings.TrimPrefix(entry.Name, dir), "/")
+		// names with empty segments like "a//b" have no fs path
+		if base == "" || strings.Contains(base, "/") {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(&fileInfo{name: base, attrs: entry.Attrs, dir: entry.IsDir}))
+	}
+	if len(entries) == 0 && name != "." {
+		// an empty folder only exists through its placeholder object
+		if _, err := fsys.bucket.AttrsCtx(fsys.ctx, dir); err != nil {
+			return nil, pathError("readdir", name, err)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// fileInfo is the fs.FileInfo of an object or a folder, Sys returns the
+// *storage.ObjectAttrs of objects
+type fileInfo struct {
+	name  string
+	attrs *storage.ObjectAttrs
+	dir   bool
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	if fi.attrs == nil {
+		return 0
+	}
+	return fi.attrs.Size
+}
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	if fi.attrs == nil {
+		return time.Time{}
+	}
+	return fi.attrs.Updated
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.dir
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	return fi.attrs
+}
+
+// fsFile is an open file of an FS
+type fsFile struct {
+	*ObjectReader
+	info *fileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// fsDir is an open folder, its entries are listed on the first ReadDir
+type fsDir struct {
+	fsys    *FS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
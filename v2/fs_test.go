@@ -0,0 +1,127 @@
+package GCPStorage
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putTree(t, bucket)
+	putString(t, bucket, "site/index.html", "<h1>index</h1>")
+	putString(t, bucket, "site/css/main.css", "body {}")
+
+	if err := fstest.TestFS(bucket.FS(""), "root.txt", "dir/a.txt", "dir/sub/b.txt", "site/css/main.css"); err != nil {
+		t.Fatal(err)
+	}
+	site := bucket.FS("site")
+	if err := fstest.TestFS(site, "index.html", "css/main.css"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(site, "css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "body {}" {
+		t.Errorf("expecting body {}, got: %s", data)
+	}
+	if _, err := fs.Stat(site, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expecting fs.ErrNotExist, got: %v", err)
+	}
+}
+
+func TestFSFileServer(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "site/index.html", "<h1>index</h1>")
+	server := httptest.NewServer(http.FileServer(http.FS(bucket.FS("site"))))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "<h1>index</h1>" {
+		t.Errorf("expecting the index page, got: %v %s", resp.Status, body)
+	}
+}
+
+func testWriteFS(t *testing.T, fsys WriteFS) {
+	if err := fsys.MkdirAll("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	w, err := fsys.Create("a/b/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Remove("a/b"); err == nil {
+		t.Error("expecting an error removing a folder with content")
+	}
+	if err := fsys.Rename("a/b/file.txt", "a/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Remove("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Rename("a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(fsys, "c/moved.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" {
+		t.Errorf("expecting data, got: %s", data)
+	}
+	if _, err := fs.Stat(fsys, "a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expecting a to be renamed, got: %v", err)
+	}
+	// the parents of a created file need no MkdirAll
+	w, err = fsys.Create("c/d/nested.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys, "c/d/nested.txt"); err != nil {
+		t.Errorf("expecting the nested file, got: %v", err)
+	}
+	if err := fsys.RemoveAll("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveAll("missing"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expecting an empty file system, got: %v", entries)
+	}
+}
+
+func TestWriteFS(t *testing.T) {
+	t.Run("bucket", func(t *testing.T) {
+		testWriteFS(t, newLocalBucket(t).FS("scratch"))
+	})
+	t.Run("dir", func(t *testing.T) {
+		testWriteFS(t, NewDirFS(t.TempDir()))
+	})
+}
@@ -0,0 +1,685 @@
+// Package gcpstoragetest provides an in-memory GCPStorage.Backend for unit tests.
+//
+// The fake keeps objects with their generations and metadata in memory,
+// records every call made to it and can be told to fail specific calls:
+//
+//	bucket, fake := gcpstoragetest.NewBucket("my-bucket")
+//	fake.FailNth(gcpstoragetest.OpWrite, 2, errors.New("boom"))
+//	fake.NotFound("config.json")
+package gcpstoragetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	GCPStorage "github.com/ahmadissa/gcp_storage/v2"
+)
+
+// Op names a Backend operation
+type Op string
+
+// Operations recorded by the fake and accepted by FailNth and FailObject
+const (
+	OpWrite   Op = "write"
+	OpRead    Op = "read"
+	OpAttrs   Op = "attrs"
+	OpList    Op = "list"
+	OpCopy    Op = "copy"
+	OpCompose Op = "compose"
+	OpDelete  Op = "delete"
+	// OpAny matches every operation in FailObject
+	OpAny Op = "*"
+)
+
+// Call is a recorded Backend call, for OpList Object holds the query prefix
+// and for OpCopy and OpCompose it holds the destination
+type Call struct {
+	Op     Op
+	Bucket string
+	Object string
+}
+
+type object struct {
+	data  []byte
+	attrs storage.ObjectAttrs
+}
+
+type nthFailure struct {
+	op  Op
+	n   int
+	err error
+}
+
+type objectFailure struct {
+	op     Op
+	object string
+	err    error
+}
+
+// Backend is an in-memory GCPStorage.Backend, the zero value is not usable, use NewBackend
+type Backend struct {
+	mu         sync.Mutex
+	buckets    map[string]map[string]*object
+	generation int64
+	calls      []Call
+	counts     map[Op]int
+	nth        []nthFailure
+	perObject  []objectFailure
+	// noncurrent are the replaced and deleted generations of every bucket
+	noncurrent map[string][]*object
+	// sessions are the resumable uploads in progress
+	sessions    map[string]*session
+	lastSession int
+
+	// Now returns the time recorded as Created and Updated of new objects
+	Now func() time.Time
+	// Versioning keeps replaced and deleted objects as noncurrent
+	// generations, like buckets with object versioning
+	Versioning bool
+}
+
+var _ GCPStorage.Backend = (*Backend)(nil)
+var _ GCPStorage.VersionedBackend = (*Backend)(nil)
+var _ GCPStorage.ResumableBackend = (*Backend)(nil)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// NewBackend creates an empty in-memory backend
+func NewBackend() *Backend {
+	return &Backend{
+		buckets:    map[string]map[string]*object{},
+		counts:     map[Op]int{},
+		noncurrent: map[string][]*object{},
+		sessions:   map[string]*session{},
+		Now:        time.Now,
+	}
+}
+
+// NewBucket creates a GCPStorage.Bucket named name stored in a new in-memory backend
+func NewBucket(name string) (*GCPStorage.Bucket, *Backend) {
+	backend := NewBackend()
+	return GCPStorage.NewBucketWithBackend(name, backend), backend
+}
+
+// Put stores data as bucket/name without recording a call. Non zero fields of
+// attrs (ContentType, Metadata, Created) are kept, the rest is computed.
+func (f *Backend) Put(bucket, name string, data []byte, attrs *storage.ObjectAttrs) *storage.ObjectAttrs {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.store(bucket, name, data, attrs)
+}
+
+// Get returns the content and attributes of bucket/name without recording a call
+func (f *Backend) Get(bucket, name string) ([]byte, *storage.ObjectAttrs, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.buckets[bucket][name]
+	if !ok {
+		return nil, nil, false
+	}
+	attrs := obj.attrs
+	attrs.Metadata = copyMetadata(attrs.Metadata)
+	return append([]byte(nil), obj.data...), &attrs, true
+}
+
+// Calls returns the calls made so far
+func (f *Backend) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallCount returns how many times op was called
+func (f *Backend) CallCount(op Op) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts[op]
+}
+
+// ResetCalls forgets the recorded calls, counts used by FailNth restart at zero
+func (f *Backend) ResetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+	f.counts = map[Op]int{}
+}
+
+// FailNth makes the nth call (starting at 1) of op fail with err
+func (f *Backend) FailNth(op Op, n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nth = append(f.nth, nthFailure{op: op, n: n, err: err})
+}
+
+// FailObject makes every call of op on object fail with err, op may be OpAny
+func (f *Backend) FailObject(op Op, object string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.perObject = append(f.perObject, objectFailure{op: op, object: object, err: err})
+}
+
+// NotFound makes every call on object report storage.ErrObjectNotExist
+func (f *Backend) NotFound(object string) {
+	f.FailObject(OpAny, object, storage.ErrObjectNotExist)
+}
+
+// record registers a call and returns the injected failure for it, if any
+func (f *Backend) record(op Op, bucket, object string) error {
+	f.calls = append(f.calls, Call{Op: op, Bucket: bucket, Object: object})
+	f.counts[op]++
+	for _, failure := range f.nth {
+		if failure.op == op && failure.n == f.counts[op] {
+			return failure.err
+		}
+	}
+	for _, failure := range f.perObject {
+		if (failure.op == op || failure.op == OpAny) && failure.object == object {
+			return failure.err
+		}
+	}
+	return nil
+}
+
+// current returns the attributes of bucket/name or nil if it does not exist, f.mu must be held
+func (f *Backend) current(bucket, name string) *storage.ObjectAttrs {
+	if obj, ok := f.buckets[bucket][name]; ok {
+		return &obj.attrs
+	}
+	return nil
+}
+
+// generationOf returns generation of bucket/name, live or noncurrent, f.mu must be held
+func (f *Backend) generationOf(bucket, name string, generation int64) (*object, bool) {
+	if obj, ok := f.buckets[bucket][name]; ok && obj.attrs.Generation == generation {
+		return obj, true
+	}
+	for _, obj := range f.noncurrent[bucket] {
+		if obj.attrs.Name == name && obj.attrs.Generation == generation {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// archive keeps the live bucket/name as a noncurrent generation if
+// Versioning is on, f.mu must be held
+func (f *Backend) archive(bucket, name string) {
+	obj, ok := f.buckets[bucket][name]
+	if !ok || !f.Versioning {
+		return
+	}
+	old := *obj
+	old.attrs.Deleted = f.Now()
+	f.noncurrent[bucket] = append(f.noncurrent[bucket], &old)
+}
+
+// store saves an object under a new generation, f.mu must be held
+func (f *Backend) store(bucket, name string, data []byte, template *storage.ObjectAttrs) *storage.ObjectAttrs {
+	if f.buckets[bucket] == nil {
+		f.buckets[bucket] = map[string]*object{}
+	}
+	f.archive(bucket, name)
+	f.generation++
+	now := f.Now()
+	md5sum := md5.Sum(data)
+	attrs := storage.ObjectAttrs{
+		Bucket:         bucket,
+		Name:           name,
+		Size:           int64(len(data)),
+		MD5:            md5sum[:],
+		CRC32C:         crc32.Checksum(data, crc32cTable),
+		Generation:     f.generation,
+		Metageneration: 1,
+		Created:        now,
+		Updated:        now,
+	}
+	if template != nil {
+		attrs.ContentType = template.ContentType
+		attrs.Metadata = copyMetadata(template.Metadata)
+		if !template.Created.IsZero() {
+			attrs.Created = template.Created
+			attrs.Updated = template.Created
+		}
+	}
+	f.buckets[bucket][name] = &object{data: append([]byte(nil), data...), attrs: attrs}
+	result := attrs
+	return &result
+}
+
+func copyMetadata(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// writer buffers the object and stores it on Close
+type writer struct {
+	ctx     context.Context
+	backend *Backend
+	bucket  string
+	object  string
+	opts    GCPStorage.WriterOptions
+	buf     bytes.Buffer
+	attrs   *storage.ObjectAttrs
+	closed  bool
+}
+
+// NewWriter implements GCPStorage.Backend, injected write failures are returned by Close
+func (f *Backend) NewWriter(ctx context.Context, bucket, object string, opts *GCPStorage.WriterOptions) GCPStorage.ObjectWriter {
+	w := &writer{ctx: ctx, backend: f, bucket: bucket, object: object}
+	if opts != nil {
+		w.opts = *opts
+	}
+	return w
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("gcpstoragetest: write on closed writer")
+	}
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	f := w.backend
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpWrite, w.bucket, w.object); err != nil {
+		return err
+	}
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if crc := crc32.Checksum(w.buf.Bytes(), crc32cTable); w.opts.SendCRC32C && crc != w.opts.CRC32C {
+		return fmt.Errorf("%w: sent crc32c %08x, received data crc32c %08x", GCPStorage.ErrChecksumMismatch, w.opts.CRC32C, crc)
+	}
+	if err := w.opts.Conditions.Check(f.current(w.bucket, w.object)); err != nil {
+		return err
+	}
+	w.attrs = f.store(w.bucket, w.object, w.buf.Bytes(), &storage.ObjectAttrs{
+		ContentType: w.opts.ContentType,
+		Metadata:    w.opts.Metadata,
+	})
+	return nil
+}
+
+func (w *writer) Attrs() *storage.ObjectAttrs {
+	return w.attrs
+}
+
+// NewRangeReader implements GCPStorage.Backend
+func (f *Backend) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpRead, bucket, object); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obj, ok := f.buckets[bucket][object]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return readRange(obj, offset, length)
+}
+
+// readRange returns a reader of length bytes of obj from offset
+func readRange(obj *object, offset, length int64) (io.ReadCloser, error) {
+	size := int64(len(obj.data))
+	if offset < 0 {
+		offset += size
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	if offset > size {
+		return nil, fmt.Errorf("gcpstoragetest: offset %d beyond the size of %q", offset, obj.attrs.Name)
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	data := append([]byte(nil), obj.data[offset:end]...)
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Attrs implements GCPStorage.Backend
+func (f *Backend) Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpAttrs, bucket, object); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obj, ok := f.buckets[bucket][object]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	attrs := obj.attrs
+	attrs.Metadata = copyMetadata(attrs.Metadata)
+	return &attrs, nil
+}
+
+// Objects implements GCPStorage.Backend, objects hidden with NotFound are
+// not listed. q.Versions lists the noncurrent generations too.
+func (f *Backend) Objects(ctx context.Context, bucket string, q *storage.Query) GCPStorage.ObjectIterator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prefix := ""
+	if q != nil {
+		prefix = q.Prefix
+	}
+	if err := f.record(OpList, bucket, prefix); err != nil {
+		return GCPStorage.NewErrorIterator(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return GCPStorage.NewErrorIterator(err)
+	}
+	objs := []*storage.ObjectAttrs{}
+	for name, obj := range f.buckets[bucket] {
+		if f.hidden(name) {
+			continue
+		}
+		attrs := obj.attrs
+		objs = append(objs, &attrs)
+	}
+	if q != nil && q.Versions {
+		for _, obj := range f.noncurrent[bucket] {
+			if f.hidden(obj.attrs.Name) {
+				continue
+			}
+			attrs := obj.attrs
+			objs = append(objs, &attrs)
+		}
+	}
+	return GCPStorage.NewSliceIterator(objs, q)
+}
+
+// hidden reports whether NotFound was called for name
+func (f *Backend) hidden(name string) bool {
+	for _, failure := range f.perObject {
+		if failure.op == OpAny && failure.object == name && failure.err == storage.ErrObjectNotExist {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy implements GCPStorage.Backend, failures injected for the source object apply too
+func (f *Backend) Copy(ctx context.Context, dstBucket, dst, srcBucket, src string, conds *GCPStorage.Conditions) (*storage.ObjectAttrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpCopy, dstBucket, dst); err != nil {
+		return nil, err
+	}
+	for _, failure := range f.perObject {
+		if (failure.op == OpCopy || failure.op == OpAny) && failure.object == src {
+			return nil, failure.err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obj, ok := f.buckets[srcBucket][src]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return f.copyObject(dstBucket, dst, obj, &GCPStorage.CopyOptions{Conditions: conds})
+}
+
+// copyObject stores a copy of obj as dstBucket/dst, f.mu must be held
+func (f *Backend) copyObject(dstBucket, dst string, obj *object, opts *GCPStorage.CopyOptions) (*storage.ObjectAttrs, error) {
+	template := &storage.ObjectAttrs{
+		ContentType: obj.attrs.ContentType,
+		Metadata:    obj.attrs.Metadata,
+	}
+	if opts != nil {
+		if err := opts.Conditions.Check(f.current(dstBucket, dst)); err != nil {
+			return nil, err
+		}
+		if opts.Metadata != nil {
+			template.Metadata = opts.Metadata
+		}
+	}
+	return f.store(dstBucket, dst, obj.data, template), nil
+}
+
+// Compose implements GCPStorage.Backend, failures injected for a source object apply too
+func (f *Backend) Compose(ctx context.Context, bucket, dst string, srcs []string, opts *GCPStorage.WriterOptions) (*storage.ObjectAttrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpCompose, bucket, dst); err != nil {
+		return nil, err
+	}
+	if len(srcs) == 0 || len(srcs) > GCPStorage.MaxComposeSources {
+		return nil, fmt.Errorf("gcpstoragetest: compose of %d sources", len(srcs))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var data []byte
+	for _, src := range srcs {
+		for _, failure := range f.perObject {
+			if (failure.op == OpCompose || failure.op == OpAny) && failure.object == src {
+				return nil, failure.err
+			}
+		}
+		obj, ok := f.buckets[bucket][src]
+		if !ok {
+			return nil, storage.ErrObjectNotExist
+		}
+		data = append(data, obj.data...)
+	}
+	template := &storage.ObjectAttrs{}
+	if opts != nil {
+		template.ContentType = opts.ContentType
+		template.Metadata = opts.Metadata
+		if err := opts.Conditions.Check(f.current(bucket, dst)); err != nil {
+			return nil, err
+		}
+	}
+	attrs := f.store(bucket, dst, data, template)
+	// composite objects have no MD5
+	attrs.MD5 = nil
+	f.buckets[bucket][dst].attrs.MD5 = nil
+	return attrs, nil
+}
+
+// Delete implements GCPStorage.Backend
+func (f *Backend) Delete(ctx context.Context, bucket, object string, conds *GCPStorage.Conditions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpDelete, bucket, object); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	obj, ok := f.buckets[bucket][object]
+	if !ok {
+		return storage.ErrObjectNotExist
+	}
+	if err := conds.Check(&obj.attrs); err != nil {
+		return err
+	}
+	f.archive(bucket, object)
+	delete(f.buckets[bucket], object)
+	return nil
+}
+
+// GenerationAttrs implements GCPStorage.VersionedBackend
+func (f *Backend) GenerationAttrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpAttrs, bucket, object); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obj, ok := f.generationOf(bucket, object, generation)
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	attrs := obj.attrs
+	attrs.Metadata = copyMetadata(attrs.Metadata)
+	return &attrs, nil
+}
+
+// NewGenerationReader implements GCPStorage.VersionedBackend
+func (f *Backend) NewGenerationReader(ctx context.Context, bucket, object string, generation, offset, length int64) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpRead, bucket, object); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obj, ok := f.generationOf(bucket, object, generation)
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return readRange(obj, offset, length)
+}
+
+// CopyGeneration implements GCPStorage.VersionedBackend
+func (f *Backend) CopyGeneration(ctx context.Context, dstBucket, dst, srcBucket, src string, generation int64, opts *GCPStorage.CopyOptions) (*storage.ObjectAttrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpCopy, dstBucket, dst); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obj, ok := f.generationOf(srcBucket, src, generation)
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return f.copyObject(dstBucket, dst, obj, opts)
+}
+
+// DeleteGeneration implements GCPStorage.VersionedBackend, deleting the live
+// generation leaves no noncurrent generation behind
+func (f *Backend) DeleteGeneration(ctx context.Context, bucket, object string, generation int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(OpDelete, bucket, object); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if obj, ok := f.buckets[bucket][object]; ok && obj.attrs.Generation == generation {
+		delete(f.buckets[bucket], object)
+		return nil
+	}
+	for i, obj := range f.noncurrent[bucket] {
+		if obj.attrs.Name == object && obj.attrs.Generation == generation {
+			f.noncurrent[bucket] = append(f.noncurrent[bucket][:i], f.noncurrent[bucket][i+1:]...)
+			return nil
+		}
+	}
+	return storage.ErrObjectNotExist
+}
+
+// session is a resumable upload in progress
+type session struct {
+	bucket string
+	object string
+	size   int64
+	opts   GCPStorage.WriterOptions
+	data   []byte
+}
+
+// StartResumable implements GCPStorage.ResumableBackend
+func (f *Backend) StartResumable(ctx context.Context, bucket, object string, size int64, opts *GCPStorage.WriterOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastSession++
+	id := fmt.Sprintf("session-%d", f.lastSession)
+	s := &session{bucket: bucket, object: object, size: size}
+	if opts != nil {
+		s.opts = *opts
+	}
+	f.sessions[id] = s
+	return id, nil
+}
+
+// ResumableStatus implements GCPStorage.ResumableBackend, completed sessions no longer exist
+func (f *Backend) ResumableStatus(ctx context.Context, id string, size int64) (int64, *storage.ObjectAttrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.sessions[id]
+	if !ok {
+		return 0, nil, storage.ErrObjectNotExist
+	}
+	return int64(len(s.data)), nil, nil
+}
+
+// WriteResumable implements GCPStorage.ResumableBackend, every chunk is
+// recorded as OpWrite so FailNth can interrupt an upload
+func (f *Backend) WriteResumable(ctx context.Context, id string, offset, size int64, data []byte) (int64, *storage.ObjectAttrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.sessions[id]
+	if !ok {
+		return 0, nil, storage.ErrObjectNotExist
+	}
+	if err := f.record(OpWrite, s.bucket, s.object); err != nil {
+		return 0, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+	if offset > int64(len(s.data)) || offset+int64(len(data)) > s.size {
+		return 0, nil, fmt.Errorf("gcpstoragetest: chunk at %d of %d bytes does not follow the %d committed bytes of %d", offset, len(data), len(s.data), s.size)
+	}
+	// data already committed past offset is sent again by the client
+	s.data = append(s.data[:offset], data...)
+	committed := int64(len(s.data))
+	if committed < s.size {
+		return committed, nil, nil
+	}
+	if err := s.opts.Conditions.Check(f.current(s.bucket, s.object)); err != nil {
+		return 0, nil, err
+	}
+	delete(f.sessions, id)
+	attrs := f.store(s.bucket, s.object, s.data, &storage.ObjectAttrs{
+		ContentType: s.opts.ContentType,
+		Metadata:    s.opts.Metadata,
+	})
+	return committed, attrs, nil
+}
+
+// Close implements GCPStorage.Backend
+func (f *Backend) Close() error {
+	return nil
+}
@@ -0,0 +1,282 @@
+package gcpstoragetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	GCPStorage "github.com/ahmadissa/gcp_storage/v2"
+)
+
+func TestUploadVerify(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	err := bucket.UploadVerify("../testFiles/localfile.txt", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, attrs, ok := fake.Get("fake", "file.txt")
+	if !ok {
+		t.Fatal("file.txt was not stored")
+	}
+	if string(data) != "test file" {
+		t.Errorf("expecting 'test file', got: %s", data)
+	}
+	if attrs.Generation == 0 {
+		t.Error("expecting a generation")
+	}
+	// the checksums come with the write, no Attrs round trip
+	want := []Call{{OpWrite, "fake", "file.txt"}}
+	calls := fake.Calls()
+	if len(calls) != len(want) || calls[0] != want[0] {
+		t.Errorf("expecting calls %v, got: %v", want, calls)
+	}
+}
+
+func TestFailNth(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	boom := errors.New("boom")
+	fake.FailNth(OpWrite, 2, boom)
+	for i, name := range []string{"a", "b", "c"} {
+		err := bucket.UploadFromReader(strings.NewReader(name), name)
+		if i == 1 && err != boom {
+			t.Errorf("expecting boom on second upload, got: %v", err)
+		}
+		if i != 1 && err != nil {
+			t.Errorf("upload %v failed: %v", name, err)
+		}
+	}
+	if _, _, ok := fake.Get("fake", "b"); ok {
+		t.Error("failed upload should not be stored")
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	fake.Put("fake", "config.json", []byte("{}"), nil)
+	fake.NotFound("config.json")
+	if _, err := bucket.Attrs("config.json"); !errors.Is(err, GCPStorage.ErrNotExist) {
+		t.Errorf("expecting ErrNotExist, got: %v", err)
+	}
+	exists, err := bucket.Exists("config.json")
+	if exists || err != nil {
+		t.Errorf("expecting false and no error, got: %v, %v", exists, err)
+	}
+	files, err := bucket.List("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expecting no files, got: %v", files)
+	}
+}
+
+func TestDeleteOldFiles(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	fake.Put("fake", "logs/old.txt", []byte("old"), &storage.ObjectAttrs{Created: time.Now().Add(-2 * time.Hour)})
+	fake.Put("fake", "logs/new.txt", []byte("new"), nil)
+	err := bucket.DeleteOldFiles("logs/", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := fake.Get("fake", "logs/old.txt"); ok {
+		t.Error("logs/old.txt should be deleted")
+	}
+	if _, _, ok := fake.Get("fake", "logs/new.txt"); !ok {
+		t.Error("logs/new.txt should be kept")
+	}
+}
+
+func TestGenerations(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	first := fake.Put("fake", "doc", []byte("1"), &storage.ObjectAttrs{Metadata: map[string]string{"k": "v"}})
+	err := bucket.CopyFile("doc", "doc-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, attrs, _ := fake.Get("fake", "doc-copy")
+	if attrs.Generation <= first.Generation {
+		t.Errorf("expecting a generation above %v, got: %v", first.Generation, attrs.Generation)
+	}
+	if attrs.Metadata["k"] != "v" {
+		t.Errorf("expecting metadata to be copied, got: %v", attrs.Metadata)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	srcs := []string{}
+	for i := 0; i < 40; i++ {
+		name := "part-" + string(rune('a'+i%26)) + strings.Repeat("x", i/26)
+		fake.Put("fake", name, []byte{byte('a' + i%26)}, nil)
+		srcs = append(srcs, name)
+	}
+	if err := bucket.Compose("all", srcs); err != nil {
+		t.Fatal(err)
+	}
+	data, attrs, ok := fake.Get("fake", "all")
+	if !ok {
+		t.Fatal("all was not stored")
+	}
+	if len(data) != 40 || attrs.MD5 != nil {
+		t.Errorf("expecting 40 bytes without md5, got: %d bytes md5 %x", len(data), attrs.MD5)
+	}
+	// two intermediate objects and the final one
+	if fake.CallCount(OpCompose) != 3 {
+		t.Errorf("expecting 3 composes, got: %v", fake.CallCount(OpCompose))
+	}
+	if files, _ := bucket.List("", 0); len(files) != 41 {
+		t.Errorf("expecting intermediate objects to be deleted, got: %v", files)
+	}
+}
+
+// overwritingBackend writes a new generation of the source after each copy
+type overwritingBackend struct {
+	*Backend
+}
+
+func (o overwritingBackend) Copy(ctx context.Context, dstBucket, dst, srcBucket, src string, conds *GCPStorage.Conditions) (*storage.ObjectAttrs, error) {
+	attrs, err := o.Backend.Copy(ctx, dstBucket, dst, srcBucket, src, conds)
+	o.Put(srcBucket, src, []byte("new"), nil)
+	return attrs, err
+}
+
+func TestMoveOverwritten(t *testing.T) {
+	fake := NewBackend()
+	bucket := GCPStorage.NewBucketWithBackend("fake", overwritingBackend{fake})
+	fake.Put("fake", "doc", []byte("old"), nil)
+	if err := bucket.Move("doc", "moved"); !errors.Is(err, GCPStorage.ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed, got: %v", err)
+	}
+	if data, _, ok := fake.Get("fake", "doc"); !ok || string(data) != "new" {
+		t.Errorf("expecting the new generation to be kept, got: %s", data)
+	}
+}
+
+func TestCreateIfAbsent(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	ctx := context.Background()
+	fake.Put("fake", "lock", []byte("owner-1"), nil)
+	_, err := bucket.UploadFromReaderIfCtx(ctx, strings.NewReader("owner-2"), "lock", GCPStorage.Conditions{DoesNotExist: true})
+	if !errors.Is(err, GCPStorage.ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed, got: %v", err)
+	}
+	if data, _, _ := fake.Get("fake", "lock"); string(data) != "owner-1" {
+		t.Errorf("expecting lock to be kept, got: %s", data)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	fake.Versioning = true
+	first := fake.Put("fake", "doc", []byte("v1"), nil)
+	fake.Put("fake", "doc", []byte("v2"), nil)
+	if err := bucket.Delete("doc"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := bucket.ListVersions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Generation != first.Generation || versions[1].Deleted.IsZero() {
+		t.Fatalf("expecting 2 noncurrent versions, got: %v", versions)
+	}
+	reader, err := bucket.GetVersionReader("doc", first.Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "v1" {
+		t.Errorf("expecting v1, got: %s %v", data, err)
+	}
+	attrs, err := bucket.RestoreVersion("doc", first.Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _, _ := fake.Get("fake", "doc"); string(data) != "v1" {
+		t.Errorf("expecting v1 to be live again, got: %s", data)
+	}
+	meta, err := bucket.GetMeta("doc")
+	if err != nil || meta.Generation != attrs.Generation {
+		t.Errorf("expecting generation %v, got: %v %v", attrs.Generation, meta.Generation, err)
+	}
+	if err := bucket.DeleteVersion("doc", first.Generation); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bucket.GetVersionReader("doc", first.Generation); !errors.Is(err, GCPStorage.ErrNotExist) {
+		t.Errorf("expecting ErrNotExist, got: %v", err)
+	}
+	if versions, _ := bucket.ListVersions("doc"); len(versions) != 2 {
+		t.Errorf("expecting v2 and the live version, got: %v", versions)
+	}
+}
+
+func TestListVersionsPages(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	fake.Versioning = true
+	for _, name := range []string{"a", "a", "a", "b", "b"} {
+		fake.Put("fake", name, []byte(name), nil)
+	}
+	// pages of 2 end between the generations of a and of b
+	q := GCPStorage.Query{Versions: true}
+	var generations []int64
+	for {
+		page, token, err := bucket.ListPage(q, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, attrs := range page {
+			generations = append(generations, attrs.Generation)
+		}
+		if token == "" {
+			break
+		}
+		q.PageToken = token
+	}
+	if fmt.Sprint(generations) != "[1 2 3 4 5]" {
+		t.Errorf("expecting every generation once, got: %v", generations)
+	}
+}
+
+func TestUploadResumable(t *testing.T) {
+	bucket, fake := NewBucket("fake")
+	content := strings.Repeat("resumable", 100000)
+	localFile := filepath.Join(t.TempDir(), "big.txt")
+	if err := ioutil.WriteFile(localFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := GCPStorage.ResumableOptions{ChunkSize: GCPStorage.ResumableChunkAlign, ContentType: "text/plain"}
+	boom := errors.New("boom")
+	fake.FailNth(OpWrite, 3, boom)
+	if err := bucket.UploadResumable(localFile, "big.txt", opts); !errors.Is(err, boom) {
+		t.Fatalf("expecting boom on the third chunk, got: %v", err)
+	}
+	if _, _, ok := fake.Get("fake", "big.txt"); ok {
+		t.Fatal("interrupted upload should not be stored")
+	}
+	fake.ResetCalls()
+	if err := bucket.UploadResumable(localFile, "big.txt", opts); err != nil {
+		t.Fatal(err)
+	}
+	// 900000 bytes in chunks of 256 KiB, two were committed before the failure
+	if n := fake.CallCount(OpWrite); n != 2 {
+		t.Errorf("expecting 2 chunks on resume, got: %v", n)
+	}
+	data, attrs, ok := fake.Get("fake", "big.txt")
+	if !ok || string(data) != content {
+		t.Fatal("uploaded content does not match")
+	}
+	if attrs.ContentType != "text/plain" {
+		t.Errorf("expecting text/plain, got: %v", attrs.ContentType)
+	}
+	if _, err := os.Stat(localFile + ".upload"); !os.IsNotExist(err) {
+		t.Errorf("expecting the state file to be removed, got: %v", err)
+	}
+}
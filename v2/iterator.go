@@ -0,0 +1,110 @@
+package GCPStorage
+
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// Query selects the objects listed by Objects
+type Query struct {
+	Prefix string
+	// Delimiter groups names sharing a prefix up to the delimiter, the groups
+	// are returned as entries with only Prefix set
+	Delimiter string
+	// StartOffset and EndOffset restrict the listing to names in [StartOffset, EndOffset)
+	StartOffset string
+	EndOffset   string
+	// PageToken resumes a listing after the page that returned it, see Iterator.PageInfo
+	PageToken string
+	// PageSize is the number of objects fetched per request, zero uses the backend default
+	PageSize int
+	// Versions lists the noncurrent generations too, see ListVersions
+	Versions bool
+}
+
+func (q Query) storageQuery() *storage.Query {
+	return &storage.Query{
+		Prefix:      q.Prefix,
+		Delimiter:   q.Delimiter,
+		StartOffset: q.StartOffset,
+		EndOffset:   q.EndOffset,
+		Versions:    q.Versions,
+	}
+}
+
+// Iterator streams object attributes from a listing
+type Iterator struct {
+	it     ObjectIterator
+	prefix string
+	err    error
+}
+
+// Objects lists the objects matching q without buffering the whole listing:
+//
+//	it := bucket.Objects(ctx, GCPStorage.Query{Prefix: "logs/"})
+//	for {
+//		attrs, err := it.Next()
+//		if err == iterator.Done {
+//			break
+//		}
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(attrs.Name, attrs.Size)
+//	}
+func (b *Bucket) Objects(ctx context.Context, q Query, optionalBucket ...string) *Iterator {
+	backend, bucket, err := b.use(optionalBucket...)
+	if err != nil {
+		return &Iterator{err: err}
+	}
+	it := backend.Objects(ctx, bucket, q.storageQuery())
+	it.PageInfo().Token = q.PageToken
+	it.PageInfo().MaxSize = q.PageSize
+	return &Iterator{it: it, prefix: q.Prefix}
+}
+
+// Next returns the next object, iterator.Done at the end of the listing
+func (it *Iterator) Next() (*storage.ObjectAttrs, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	attrs, err := it.it.Next()
+	if err == iterator.Done {
+		return nil, err
+	}
+	if err != nil {
+		it.err = wrapErr("Objects", it.prefix, err)
+		return nil, it.err
+	}
+	return attrs, nil
+}
+
+// PageInfo supports pagination with iterator.NewPager, PageInfo().Token is
+// the token of the next page once the current page is consumed
+func (it *Iterator) PageInfo() *iterator.PageInfo {
+	if it.it == nil {
+		return NewErrorIterator(it.err).PageInfo()
+	}
+	return it.it.PageInfo()
+}
+
+// ListPage returns a page of at most pageSize objects matching q and the
+// token of the next page, empty after the last page
+func (b *Bucket) ListPage(q Query, pageSize int, optionalBucket ...string) (objects []*storage.ObjectAttrs, nextPageToken string, err error) {
+	return b.ListPageCtx(context.Background(), q, pageSize, optionalBucket...)
+}
+
+// ListPageCtx is ListPage with a context
+func (b *Bucket) ListPageCtx(ctx context.Context, q Query, pageSize int, optionalBucket ...string) (objects []*storage.ObjectAttrs, nextPageToken string, err error) {
+	it := b.Objects(ctx, q, optionalBucket...)
+	if it.err != nil {
+		return nil, "", it.err
+	}
+	nextPageToken, err = iterator.NewPager(it, pageSize, q.PageToken).NextPage(&objects)
+	if err != nil {
+		return nil, "", wrapErr("ListPage", q.Prefix, err)
+	}
+	return objects, nextPageToken, nil
+}
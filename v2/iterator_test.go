@@ -0,0 +1,103 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+func collectNames(t *testing.T, it *Iterator) string {
+	names := []string{}
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, attrs.Name+attrs.Prefix)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestObjectsOffsets(t *testing.T) {
+	bucket := newLocalBucket(t)
+	for _, name := range []string{"a", "b", "c", "d", "dir/e"} {
+		putString(t, bucket, name, name)
+	}
+	ctx := context.Background()
+	got := collectNames(t, bucket.Objects(ctx, Query{StartOffset: "b", EndOffset: "d"}))
+	if got != "b,c" {
+		t.Errorf("expecting b,c, got: %v", got)
+	}
+	got = collectNames(t, bucket.Objects(ctx, Query{Delimiter: "/"}))
+	if got != "a,b,c,d,dir/" {
+		t.Errorf("expecting a,b,c,d,dir/, got: %v", got)
+	}
+}
+
+func TestListPage(t *testing.T) {
+	bucket := newLocalBucket(t)
+	for _, name := range []string{"p/1", "p/2", "p/3", "p/4", "p/5"} {
+		putString(t, bucket, name, name)
+	}
+	ctx := context.Background()
+	q := Query{Prefix: "p/"}
+	pages := []string{}
+	for {
+		objects, token, err := bucket.ListPageCtx(ctx, q, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, attrs := range objects {
+			names = append(names, attrs.Name)
+		}
+		pages = append(pages, strings.Join(names, ","))
+		if token == "" {
+			break
+		}
+		q.PageToken = token
+	}
+	want := "p/1,p/2|p/3,p/4|p/5"
+	if strings.Join(pages, "|") != want {
+		t.Errorf("expecting %v, got: %v", want, strings.Join(pages, "|"))
+	}
+}
+
+func TestListLimit(t *testing.T) {
+	bucket := newLocalBucket(t)
+	for _, name := range []string{"1", "2", "3"} {
+		putString(t, bucket, name, name)
+	}
+	files, err := bucket.List("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expecting 2 files, got: %v", files)
+	}
+}
+
+// failingListBackend fails every listing
+type failingListBackend struct {
+	Backend
+	err error
+}
+
+func (f *failingListBackend) Objects(ctx context.Context, bucket string, q *storage.Query) ObjectIterator {
+	return NewErrorIterator(f.err)
+}
+
+func TestListError(t *testing.T) {
+	listErr := errors.New("list failed")
+	bucket := NewBucketWithBackend("local", &failingListBackend{Backend: getLocalBackend(t), err: listErr})
+	if _, err := bucket.List("", 0); !errors.Is(err, listErr) {
+		t.Errorf("expecting list failed, got: %v", err)
+	}
+}
@@ -0,0 +1,602 @@
+package GCPStorage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// localAttrsDir holds the object attributes next to the bucket directories,
+// bucket names cannot start with a dot so it never clashes with a bucket
+const localAttrsDir = ".attrs"
+
+// localTempDir holds uploads until they are committed
+const localTempDir = ".tmp"
+
+// localFolderFile stores objects named like a folder ("dir/") inside the
+// folder directory, so placeholders and the objects under them can coexist
+const localFolderFile = ".gcpstorage-folder"
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// LocalFSBackend is a Backend keeping every bucket in a directory under root,
+// the object "a/b.txt" of bucket "files" is stored in root/files/a/b.txt.
+// Attributes cloud storage keeps for an object (content type, checksums,
+// generation) are stored in root/.attrs, objects written to the directory by
+// other programs get their attributes computed on demand.
+//
+// Since objects are files, an object cannot share its name with a folder,
+// e.g. "a" and "a/b" cannot both exist. Folder placeholders like "a/" are
+// supported.
+type LocalFSBackend struct {
+	root     string
+	mu       sync.Mutex
+	endpoint string
+	secret   []byte
+}
+
+var _ VersionedBackend = (*LocalFSBackend)(nil)
+
+// localAttrs is the on disk form of the attributes of an object
+type localAttrs struct {
+	ContentType    string            `json:"contentType,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	Generation     int64             `json:"generation"`
+	Metageneration int64             `json:"metageneration"`
+	Created        time.Time         `json:"created"`
+	Updated        time.Time         `json:"updated"`
+	MD5            []byte            `json:"md5"`
+	CRC32C         uint32            `json:"crc32c"`
+	Size           int64             `json:"size"`
+	ModTime        time.Time         `json:"modTime"`
+	Public         bool              `json:"public,omitempty"`
+}
+
+// NewLocalFSBackend creates a backend storing buckets under the root directory
+func NewLocalFSBackend(root string) (*LocalFSBackend, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &LocalFSBackend{root: root, secret: secret}, nil
+}
+
+// NewLocalBucket creates a Bucket named name stored under the root directory
+func NewLocalBucket(root, name string) (*Bucket, error) {
+	backend, err := NewLocalFSBackend(root)
+	if err != nil {
+		return nil, err
+	}
+	return NewBucketWithBackend(name, backend), nil
+}
+
+// Root returns the directory holding the buckets
+func (l *LocalFSBackend) Root() string {
+	return l.root
+}
+
+// path returns the data and attributes paths of an object
+func (l *LocalFSBackend) path(bucket, object string) (data, attrs string, err error) {
+	if bucket == "" || strings.HasPrefix(bucket, ".") || strings.ContainsAny(bucket, `/\`) {
+		return "", "", fmt.Errorf("GCPStorage: invalid bucket name %q", bucket)
+	}
+	if object == "" || strings.HasSuffix("/"+object, "/"+localFolderFile) {
+		return "", "", fmt.Errorf("GCPStorage: invalid object name %q", object)
+	}
+	name := filepath.FromSlash(object)
+	if strings.HasSuffix(object, "/") {
+		name = filepath.Join(name, localFolderFile)
+	}
+	bucketDir := filepath.Join(l.root, bucket)
+	data = filepath.Join(bucketDir, name)
+	if !strings.HasPrefix(data, bucketDir+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("GCPStorage: invalid object name %q", object)
+	}
+	attrs = filepath.Join(l.root, localAttrsDir, bucket, name) + ".json"
+	return data, attrs, nil
+}
+
+// readAttrs loads the attributes of an object
+func (l *LocalFSBackend) readAttrs(bucket, object string) (*storage.ObjectAttrs, error) {
+	la, err := l.readLocalAttrs(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	return la.objectAttrs(bucket, object), nil
+}
+
+// readLocalAttrs loads the stored attributes of an object, computing them if they are missing or stale
+func (l *LocalFSBackend) readLocalAttrs(bucket, object string) (localAttrs, error) {
+	dataPath, attrsPath, err := l.path(bucket, object)
+	if err != nil {
+		return localAttrs{}, err
+	}
+	info, err := os.Stat(dataPath)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return localAttrs{}, storage.ErrObjectNotExist
+	}
+	if err != nil {
+		return localAttrs{}, err
+	}
+	la := localAttrs{}
+	data, err := ioutil.ReadFile(attrsPath)
+	if err == nil {
+		err = json.Unmarshal(data, &la)
+	}
+	if err != nil || la.Size != info.Size() || !la.ModTime.Equal(info.ModTime()) {
+		return computeLocalAttrs(dataPath, info)
+	}
+	return la, nil
+}
+
+// writeLocalAttrs stores the attributes of an object
+func (l *LocalFSBackend) writeLocalAttrs(bucket, object string, la localAttrs) error {
+	_, attrsPath, err := l.path(bucket, object)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(la)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(attrsPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(attrsPath, data, 0644)
+}
+
+// computeLocalAttrs builds attributes for a file written outside the backend
+func computeLocalAttrs(dataPath string, info os.FileInfo) (localAttrs, error) {
+	file, err := os.Open(dataPath)
+	if err != nil {
+		return localAttrs{}, err
+	}
+	defer file.Close()
+	md5h := md5.New()
+	crc := crc32.New(crc32cTable)
+	if _, err := io.Copy(io.MultiWriter(md5h, crc), file); err != nil {
+		return localAttrs{}, err
+	}
+	return localAttrs{
+		Generation:     info.ModTime().UnixNano(),
+		Metageneration: 1,
+		Created:        info.ModTime(),
+		Updated:        info.ModTime(),
+		MD5:            md5h.Sum(nil),
+		CRC32C:         crc.Sum32(),
+		Size:           info.Size(),
+		ModTime:        info.ModTime(),
+	}, nil
+}
+
+func (la localAttrs) objectAttrs(bucket, object string) *storage.ObjectAttrs {
+	return &storage.ObjectAttrs{
+		Bucket:         bucket,
+		Name:           object,
+		ContentType:    la.ContentType,
+		Metadata:       la.Metadata,
+		Size:           la.Size,
+		MD5:            la.MD5,
+		CRC32C:         la.CRC32C,
+		Generation:     la.Generation,
+		Metageneration: la.Metageneration,
+		Created:        la.Created,
+		Updated:        la.Updated,
+	}
+}
+
+// commit moves the temporary file tmp into place as object and records its attributes
+func (l *LocalFSBackend) commit(bucket, object, tmp string, la localAttrs, conds *Conditions) (*storage.ObjectAttrs, error) {
+	dataPath, _, err := l.path(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	la.Created = now
+	la.Updated = now
+	la.Generation = now.UnixNano()
+	la.Metageneration = 1
+	prev, err := l.readAttrs(bucket, object)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, err
+	}
+	if err := conds.Check(prev); err != nil {
+		return nil, err
+	}
+	if prev != nil && prev.Generation >= la.Generation {
+		la.Generation = prev.Generation + 1
+	}
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, dataPath); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	la.ModTime = info.ModTime()
+	if err := l.writeLocalAttrs(bucket, object, la); err != nil {
+		return nil, err
+	}
+	return la.objectAttrs(bucket, object), nil
+}
+
+// localWriter writes into a temporary file which is committed on Close
+type localWriter struct {
+	ctx     context.Context
+	backend *LocalFSBackend
+	bucket  string
+	object  string
+	opts    WriterOptions
+	file    *os.File
+	md5     hash.Hash
+	crc     hash.Hash32
+	size    int64
+	err     error
+	attrs   *storage.ObjectAttrs
+	// composite objects have no MD5
+	composite bool
+}
+
+// NewWriter implements Backend
+func (l *LocalFSBackend) NewWriter(ctx context.Context, bucket, object string, opts *WriterOptions) ObjectWriter {
+	w := &localWriter{
+		ctx:     ctx,
+		backend: l,
+		bucket:  bucket,
+		object:  object,
+		md5:     md5.New(),
+		crc:     crc32.New(crc32cTable),
+	}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if _, _, err := l.path(bucket, object); err != nil {
+		w.err = err
+		return w
+	}
+	tmpDir := filepath.Join(l.root, localTempDir)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		w.err = err
+		return w
+	}
+	w.file, w.err = ioutil.TempFile(tmpDir, "upload-")
+	return w
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.err = err
+		return 0, err
+	}
+	n, err := w.file.Write(p)
+	w.md5.Write(p[:n])
+	w.crc.Write(p[:n])
+	w.size += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *localWriter) Close() error {
+	if w.file == nil {
+		return w.err
+	}
+	tmp := w.file.Name()
+	defer os.Remove(tmp)
+	if err := w.file.Close(); err != nil && w.err == nil {
+		w.err = err
+	}
+	w.file = nil
+	if w.err == nil {
+		w.err = w.ctx.Err()
+	}
+	if w.err == nil && w.opts.SendCRC32C && w.crc.Sum32() != w.opts.CRC32C {
+		w.err = fmt.Errorf("%w: sent crc32c %08x, received data crc32c %08x", ErrChecksumMismatch, w.opts.CRC32C, w.crc.Sum32())
+	}
+	if w.err != nil {
+		return w.err
+	}
+	la := localAttrs{
+		ContentType: w.opts.ContentType,
+		Metadata:    w.opts.Metadata,
+		MD5:         w.md5.Sum(nil),
+		CRC32C:      w.crc.Sum32(),
+		Size:        w.size,
+	}
+	if w.composite {
+		la.MD5 = nil
+	}
+	w.attrs, w.err = w.backend.commit(w.bucket, w.object, tmp, la, w.opts.Conditions)
+	return w.err
+}
+
+func (w *localWriter) Attrs() *storage.ObjectAttrs {
+	return w.attrs
+}
+
+// localReader closes the underlying file of a limited reader
+type localReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (r *localReader) Close() error {
+	return r.file.Close()
+}
+
+// NewRangeReader implements Backend
+func (l *LocalFSBackend) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, error) {
+	reader, _, err := l.openRange(ctx, bucket, object, 0, offset, length)
+	return reader, err
+}
+
+// openRange reads generation of object like NewRangeReader, 0 is the live
+// generation. The attributes and the file are opened under the lock so they
+// belong to the same generation.
+func (l *LocalFSBackend) openRange(ctx context.Context, bucket, object string, generation, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	dataPath, _, err := l.path(bucket, object)
+	if err != nil {
+		return nil, nil, err
+	}
+	l.mu.Lock()
+	attrs, err := l.readAttrs(bucket, object)
+	if err == nil && generation != 0 && attrs.Generation != generation {
+		// only the live generation is kept
+		err = storage.ErrObjectNotExist
+	}
+	var file *os.File
+	if err == nil {
+		file, err = os.Open(dataPath)
+	}
+	l.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset < 0 {
+		offset += attrs.Size
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	if offset > attrs.Size {
+		file.Close()
+		return nil, nil, fmt.Errorf("GCPStorage: offset %d beyond the size of %q", offset, object)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	var reader io.Reader = file
+	if length >= 0 {
+		reader = io.LimitReader(file, length)
+	}
+	return &localReader{Reader: reader, file: file}, attrs, nil
+}
+
+// Attrs implements Backend
+func (l *LocalFSBackend) Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.readAttrs(bucket, object)
+}
+
+// Objects implements Backend
+func (l *LocalFSBackend) Objects(ctx context.Context, bucket string, q *storage.Query) ObjectIterator {
+	objs, err := l.listAll(ctx, bucket)
+	if err != nil {
+		return NewErrorIterator(err)
+	}
+	return NewSliceIterator(objs, q)
+}
+
+// listAll returns the attributes of every object in bucket
+func (l *LocalFSBackend) listAll(ctx context.Context, bucket string) ([]*storage.ObjectAttrs, error) {
+	bucketDir := filepath.Join(l.root, bucket)
+	objs := []*storage.ObjectAttrs{}
+	err := filepath.Walk(bucketDir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == bucketDir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(bucketDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if info.Name() == localFolderFile {
+			name = strings.TrimSuffix(name, localFolderFile)
+		}
+		attrs, err := l.readAttrs(bucket, name)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, attrs)
+		return nil
+	})
+	return objs, err
+}
+
+// Copy implements Backend
+func (l *LocalFSBackend) Copy(ctx context.Context, dstBucket, dst, srcBucket, src string, conds *Conditions) (*storage.ObjectAttrs, error) {
+	return l.CopyGeneration(ctx, dstBucket, dst, srcBucket, src, 0, &CopyOptions{Conditions: conds})
+}
+
+// CopyGeneration implements VersionedBackend, generation 0 copies the live object
+func (l *LocalFSBackend) CopyGeneration(ctx context.Context, dstBucket, dst, srcBucket, src string, generation int64, opts *CopyOptions) (*storage.ObjectAttrs, error) {
+	reader, srcAttrs, err := l.openRange(ctx, srcBucket, src, generation, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	metadata := srcAttrs.Metadata
+	if opts != nil && opts.Metadata != nil {
+		metadata = opts.Metadata
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := l.NewWriter(ctx, dstBucket, dst, &WriterOptions{
+		ContentType: srcAttrs.ContentType,
+		Metadata:    metadata,
+		Conditions:  opts.conditions(),
+	})
+	if _, err := io.Copy(w, reader); err != nil {
+		cancel()
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return w.Attrs(), nil
+}
+
+// Compose implements Backend
+func (l *LocalFSBackend) Compose(ctx context.Context, bucket, dst string, srcs []string, opts *WriterOptions) (*storage.ObjectAttrs, error) {
+	if len(srcs) == 0 || len(srcs) > MaxComposeSources {
+		return nil, errComposeSources
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := l.NewWriter(ctx, bucket, dst, opts).(*localWriter)
+	w.composite = true
+	for _, src := range srcs {
+		if err := l.appendObject(ctx, w, bucket, src); err != nil {
+			cancel()
+			w.Close()
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return w.Attrs(), nil
+}
+
+// appendObject copies the content of object into w
+func (l *LocalFSBackend) appendObject(ctx context.Context, w io.Writer, bucket, object string) error {
+	reader, err := l.NewRangeReader(ctx, bucket, object, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// Delete implements Backend
+func (l *LocalFSBackend) Delete(ctx context.Context, bucket, object string, conds *Conditions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dataPath, attrsPath, err := l.path(bucket, object)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if info, err := os.Stat(dataPath); os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return storage.ErrObjectNotExist
+	}
+	if conds != nil {
+		attrs, err := l.readAttrs(bucket, object)
+		if err != nil {
+			return err
+		}
+		if err := conds.Check(attrs); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(dataPath); err != nil {
+		return err
+	}
+	if err := os.Remove(attrsPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// folders only exist while they hold objects
+	removeEmptyParents(filepath.Dir(dataPath), filepath.Join(l.root, bucket))
+	removeEmptyParents(filepath.Dir(attrsPath), filepath.Join(l.root, localAttrsDir, bucket))
+	return nil
+}
+
+// removeEmptyParents removes dir and its parents up to stop while they are empty
+func removeEmptyParents(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// GenerationAttrs implements VersionedBackend, like a bucket without
+// versioning only the live generation exists
+func (l *LocalFSBackend) GenerationAttrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	attrs, err := l.Attrs(ctx, bucket, object)
+	if err == nil && attrs.Generation != generation {
+		return nil, storage.ErrObjectNotExist
+	}
+	return attrs, err
+}
+
+// NewGenerationReader implements VersionedBackend
+func (l *LocalFSBackend) NewGenerationReader(ctx context.Context, bucket, object string, generation, offset, length int64) (io.ReadCloser, error) {
+	reader, _, err := l.openRange(ctx, bucket, object, generation, offset, length)
+	return reader, err
+}
+
+// DeleteGeneration implements VersionedBackend
+func (l *LocalFSBackend) DeleteGeneration(ctx context.Context, bucket, object string, generation int64) error {
+	err := l.Delete(ctx, bucket, object, &Conditions{GenerationMatch: generation})
+	if err == errPrecondition {
+		return storage.ErrObjectNotExist
+	}
+	return err
+}
+
+// Close implements Backend
+func (l *LocalFSBackend) Close() error {
+	return nil
+}
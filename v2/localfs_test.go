@@ -0,0 +1,183 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+func newLocalBucket(t *testing.T) *Bucket {
+	bucket, err := NewLocalBucket(t.TempDir(), "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bucket
+}
+
+func putString(t *testing.T, bucket *Bucket, name, content string) {
+	err := bucket.UploadFromReader(strings.NewReader(content), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalFSExternalFile(t *testing.T) {
+	bucket := newLocalBucket(t)
+	root := bucket.Backend().(*LocalFSBackend).Root()
+	err := os.MkdirAll(filepath.Join(root, "local", "dir"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "local", "dir", "file.txt"), []byte("test file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md5, err := bucket.MD5("dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md5 != "f20d9f2072bbeb6691c0f9c5099b01f3" {
+		t.Errorf("md5 didnt match expecting f20d9f2072bbeb6691c0f9c5099b01f3, got: %v", md5)
+	}
+}
+
+func TestLocalFSDelimiter(t *testing.T) {
+	bucket := newLocalBucket(t)
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/sub/c.txt", "other/d.txt"} {
+		putString(t, bucket, name, name)
+	}
+	it := bucket.Backend().Objects(context.Background(), "local", &storage.Query{Delimiter: "/"})
+	got := []string{}
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, attrs.Name+attrs.Prefix)
+	}
+	want := "a.txt,dir/,other/"
+	if strings.Join(got, ",") != want {
+		t.Errorf("expecting %v, got: %v", want, got)
+	}
+}
+
+func TestLocalFSCancelledWrite(t *testing.T) {
+	bucket := newLocalBucket(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	w := bucket.Backend().NewWriter(ctx, "local", "cancelled.txt", nil)
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := w.Close(); err != context.Canceled {
+		t.Fatalf("expecting context.Canceled, got: %v", err)
+	}
+	if _, err := bucket.Attrs("cancelled.txt"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("expecting ErrNotExist, got: %v", err)
+	}
+}
+
+func TestLocalFSRangeReader(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "range.txt", "0123456789")
+	reader, err := bucket.Backend().NewRangeReader(context.Background(), "local", "range.txt", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "234" {
+		t.Errorf("expecting 234, got: %s", data)
+	}
+}
+
+func TestLocalFSInvalidName(t *testing.T) {
+	bucket := newLocalBucket(t)
+	err := bucket.UploadFromReader(strings.NewReader("x"), "../escape.txt")
+	if err == nil {
+		t.Fatal("expecting an error for an object outside the bucket")
+	}
+}
+
+func TestLocalFSMakePublic(t *testing.T) {
+	bucket := newLocalBucket(t)
+	backend := bucket.Backend().(*LocalFSBackend)
+	server := httptest.NewServer(backend.Handler())
+	defer server.Close()
+	backend.SetEndpoint(server.URL)
+	putString(t, bucket, "public.txt", "public")
+
+	resp, err := http.Get(backend.ObjectURL("local", "public.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expecting 403 before MakePublic, got: %v", resp.Status)
+	}
+	publicURL, err := bucket.MakePublic("public.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := readURL(publicURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != "public" {
+		t.Errorf("expecting public, got: %v", data)
+	}
+}
+
+func TestLocalFSWithoutEndpoint(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "file.txt", "data")
+	if _, err := bucket.GetSignedURL("file.txt", time.Minute); err != ErrNotSupported {
+		t.Errorf("expecting ErrNotSupported, got: %v", err)
+	}
+}
+
+func TestLocalFSGenerations(t *testing.T) {
+	bucket := newLocalBucket(t)
+	backend := bucket.Backend().(*LocalFSBackend)
+	ctx := context.Background()
+	putString(t, bucket, "doc", "v1")
+	first, err := bucket.Attrs("doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	putString(t, bucket, "doc", "v2")
+	// like a bucket without versioning the replaced generation is gone
+	if _, err := backend.NewGenerationReader(ctx, "local", "doc", first.Generation, 0, -1); err != storage.ErrObjectNotExist {
+		t.Errorf("expecting ErrObjectNotExist, got: %v", err)
+	}
+	if err := backend.DeleteGeneration(ctx, "local", "doc", first.Generation); err != storage.ErrObjectNotExist {
+		t.Errorf("expecting ErrObjectNotExist, got: %v", err)
+	}
+	live, err := bucket.Attrs("doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := backend.CopyGeneration(ctx, "local", "copy", "local", "doc", live.Generation, &CopyOptions{Metadata: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Metadata["k"] != "v" || attrs.CRC32C != live.CRC32C {
+		t.Errorf("expecting a copy of the live generation with new metadata, got: %+v", attrs)
+	}
+}
@@ -0,0 +1,151 @@
+package GCPStorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"cloud.google.com/go/storage"
+)
+
+var _ ResumableBackend = (*LocalFSBackend)(nil)
+
+// localSession is the on disk form of a resumable session, its data is
+// stored next to it until the upload completes
+type localSession struct {
+	Bucket      string            `json:"bucket"`
+	Object      string            `json:"object"`
+	Size        int64             `json:"size"`
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// sessionPaths returns the state and data paths of session
+func (l *LocalFSBackend) sessionPaths(session string) (string, string, error) {
+	if _, err := hex.DecodeString(session); err != nil || session == "" {
+		return "", "", fmt.Errorf("GCPStorage: invalid session %q", session)
+	}
+	dir := filepath.Join(l.root, localTempDir, "sessions")
+	return filepath.Join(dir, session+".json"), filepath.Join(dir, session+".data"), nil
+}
+
+func (l *LocalFSBackend) readSession(session string) (*localSession, string, error) {
+	statePath, dataPath, err := l.sessionPaths(session)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return nil, "", storage.ErrObjectNotExist
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	s := &localSession{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, "", err
+	}
+	return s, dataPath, nil
+}
+
+// StartResumable implements ResumableBackend, the session is a directory entry under root
+func (l *LocalFSBackend) StartResumable(ctx context.Context, bucket, object string, size int64, opts *WriterOptions) (string, error) {
+	if _, _, err := l.path(bucket, object); err != nil {
+		return "", err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	session := hex.EncodeToString(id)
+	statePath, dataPath, err := l.sessionPaths(session)
+	if err != nil {
+		return "", err
+	}
+	s := localSession{Bucket: bucket, Object: object, Size: size}
+	if opts != nil {
+		s.ContentType = opts.ContentType
+		s.Metadata = opts.Metadata
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(dataPath, nil, 0644); err != nil {
+		return "", err
+	}
+	return session, ioutil.WriteFile(statePath, data, 0644)
+}
+
+// ResumableStatus implements ResumableBackend, completed sessions no longer exist
+func (l *LocalFSBackend) ResumableStatus(ctx context.Context, session string, size int64) (int64, *storage.ObjectAttrs, error) {
+	_, dataPath, err := l.readSession(session)
+	if err != nil {
+		return 0, nil, err
+	}
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	return info.Size(), nil, nil
+}
+
+// WriteResumable implements ResumableBackend
+func (l *LocalFSBackend) WriteResumable(ctx context.Context, session string, offset, size int64, data []byte) (int64, *storage.ObjectAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+	s, dataPath, err := l.readSession(session)
+	if err != nil {
+		return 0, nil, err
+	}
+	file, err := os.OpenFile(dataPath, os.O_RDWR, 0644)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+	if offset > info.Size() || offset+int64(len(data)) > s.Size {
+		return 0, nil, fmt.Errorf("GCPStorage: chunk at %d of %d bytes does not follow the %d committed bytes of %d", offset, len(data), info.Size(), s.Size)
+	}
+	// data already committed past offset is sent again by the client
+	if err := file.Truncate(offset); err != nil {
+		return 0, nil, err
+	}
+	if _, err := file.WriteAt(data, offset); err != nil {
+		return 0, nil, err
+	}
+	committed := offset + int64(len(data))
+	if committed < s.Size {
+		return committed, nil, nil
+	}
+	md5sum, crc, err := fileChecksums(file)
+	if err != nil {
+		return 0, nil, err
+	}
+	file.Close()
+	attrs, err := l.commit(s.Bucket, s.Object, dataPath, localAttrs{
+		ContentType: s.ContentType,
+		Metadata:    s.Metadata,
+		MD5:         md5sum,
+		CRC32C:      crc,
+		Size:        committed,
+	}, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	statePath, _, _ := l.sessionPaths(session)
+	os.Remove(statePath)
+	return committed, attrs, nil
+}
@@ -0,0 +1,122 @@
+package GCPStorage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+var _ URLBackend = (*LocalFSBackend)(nil)
+
+// SetEndpoint sets the URL where Handler is served, e.g. the URL of an
+// httptest.Server. Signed and public URLs need an endpoint.
+func (l *LocalFSBackend) SetEndpoint(endpoint string) {
+	l.endpoint = strings.TrimSuffix(endpoint, "/")
+}
+
+// ObjectURL returns the URL Handler serves object at
+func (l *LocalFSBackend) ObjectURL(bucket, object string) string {
+	return l.endpoint + "/" + bucket + "/" + object
+}
+
+// sign returns the signature of a URL for object valid until expires
+func (l *LocalFSBackend) sign(bucket, object string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(bucket + "/" + object + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURL implements URLBackend, the URL is valid for Handler of this backend only
+func (l *LocalFSBackend) SignedURL(ctx context.Context, bucket, object string, expires time.Time) (string, error) {
+	if l.endpoint == "" {
+		return "", ErrNotSupported
+	}
+	if _, err := l.Attrs(ctx, bucket, object); err != nil {
+		return "", err
+	}
+	unix := expires.Unix()
+	return l.ObjectURL(bucket, object) + "?expires=" + strconv.FormatInt(unix, 10) + "&signature=" + l.sign(bucket, object, unix), nil
+}
+
+// MakePublic implements URLBackend
+func (l *LocalFSBackend) MakePublic(ctx context.Context, bucket, object string) (string, error) {
+	if l.endpoint == "" {
+		return "", ErrNotSupported
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	la, err := l.readLocalAttrs(bucket, object)
+	if err != nil {
+		return "", err
+	}
+	la.Public = true
+	if err := l.writeLocalAttrs(bucket, object, la); err != nil {
+		return "", err
+	}
+	return l.ObjectURL(bucket, object), nil
+}
+
+// Handler serves objects at /<bucket>/<object> the way cloud storage serves
+// public objects and signed URLs, it stands in for storage.googleapis.com in tests.
+func (l *LocalFSBackend) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		bucket, object := parts[0], parts[1]
+		la, err := l.readLocalAttrs(bucket, object)
+		if err == storage.ErrObjectNotExist {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !la.Public && !l.validSignature(bucket, object, r) {
+			http.Error(w, "access denied", http.StatusForbidden)
+			return
+		}
+		reader, err := l.NewRangeReader(r.Context(), bucket, object, 0, -1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer reader.Close()
+		if la.ContentType != "" {
+			w.Header().Set("Content-Type", la.ContentType)
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(la.Size, 10))
+		if r.Method == http.MethodHead {
+			return
+		}
+		io.Copy(w, reader)
+	})
+}
+
+// validSignature checks the signature and expiry of a signed URL request
+func (l *LocalFSBackend) validSignature(bucket, object string, r *http.Request) bool {
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	signature := r.URL.Query().Get("signature")
+	return hmac.Equal([]byte(signature), []byte(l.sign(bucket, object, expires)))
+}
@@ -0,0 +1,250 @@
+package GCPStorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// Metadata keys of lock objects
+const (
+	// MetadataLockExpires is the time the lease of a lock ends, in RFC 3339
+	MetadataLockExpires = "gcpstorage-lock-expires"
+	// MetadataLockHolder identifies the process holding a lock
+	MetadataLockHolder = "gcpstorage-lock-holder"
+)
+
+var (
+	// ErrLocked is returned by TryLock when another holder has the lock
+	ErrLocked = errors.New("GCPStorage: lock is held")
+	// ErrLockLost is reported when the lease of a lock was not renewed in
+	// time and another holder may have taken it
+	ErrLockLost = errors.New("GCPStorage: lock lost")
+)
+
+// lockPollInterval is how often LockCtx tries to take a held lock
+const lockPollInterval = time.Second
+
+// Lock is a lease on an object of a bucket, it is renewed in the background
+// until Unlock. Expiry times come from the clocks of the holders, their
+// difference must stay well below the ttl.
+type Lock struct {
+	backend Backend
+	bucket  string
+	name    string
+	ttl     time.Duration
+	holder  string
+
+	mu         sync.Mutex
+	generation int64
+	err        error
+	lost       chan struct{}
+	done       chan struct{}
+	stopOnce   sync.Once
+	stopped    chan struct{}
+}
+
+// TryLock takes the lock name for ttl or returns ErrLocked if another holder
+// has it. The lock object is created only if it does not exist, an expired
+// lock is taken over with a generation precondition so a single contender
+// wins. The lease is renewed every ttl/3 until Unlock.
+func (b *Bucket) TryLock(name string, ttl time.Duration) (*Lock, error) {
+	return b.TryLockCtx(context.Background(), name, ttl)
+}
+
+// TryLockCtx is TryLock with a context, ctx only bounds the acquisition
+func (b *Bucket) TryLockCtx(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return nil, err
+	}
+	// renewals run every ttl/3, which must not be zero
+	if ttl < 3 {
+		return nil, fmt.Errorf("GCPStorage: invalid lock ttl %v", ttl)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	l := &Lock{
+		backend: backend,
+		bucket:  bucket,
+		name:    name,
+		ttl:     ttl,
+		holder:  fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(id)),
+		lost:    make(chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	go l.renew()
+	return l, nil
+}
+
+// Lock waits until it takes the lock name, see TryLock
+func (b *Bucket) Lock(name string, ttl time.Duration) (*Lock, error) {
+	return b.LockCtx(context.Background(), name, ttl)
+}
+
+// LockCtx is Lock with a context, cancelling ctx stops waiting
+func (b *Bucket) LockCtx(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	for {
+		l, err := b.TryLockCtx(ctx, name, ttl)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		timer := time.NewTimer(lockPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// write stores the lock object with a new expiry if conds hold
+func (l *Lock) write(ctx context.Context, conds *Conditions) (*storage.ObjectAttrs, error) {
+	return writeObject(ctx, l.backend, l.bucket, l.name, strings.NewReader(""), &WriterOptions{
+		Metadata: map[string]string{
+			MetadataLockExpires: time.Now().Add(l.ttl).UTC().Format(time.RFC3339Nano),
+			MetadataLockHolder:  l.holder,
+		},
+		Conditions: conds,
+	})
+}
+
+// acquire creates the lock object or takes over an expired one
+func (l *Lock) acquire(ctx context.Context) error {
+	for {
+		attrs, err := l.write(ctx, &Conditions{DoesNotExist: true})
+		if err == nil {
+			l.generation = attrs.Generation
+			return nil
+		}
+		if !errors.Is(wrapErr("Lock", l.name, err), ErrPreconditionFailed) {
+			return wrapErr("Lock", l.name, err)
+		}
+		current, err := l.backend.Attrs(ctx, l.bucket, l.name)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			// released meanwhile
+			continue
+		}
+		if err != nil {
+			return wrapErr("Lock", l.name, err)
+		}
+		expires, err := time.Parse(time.RFC3339Nano, current.Metadata[MetadataLockExpires])
+		if err == nil && time.Now().Before(expires) {
+			return &Error{Op: "Lock", Object: l.name, Kind: ErrLocked,
+				Err: fmt.Errorf("%w by %s until %v", ErrLocked, current.Metadata[MetadataLockHolder], expires)}
+		}
+		attrs, err = l.write(ctx, &Conditions{GenerationMatch: current.Generation})
+		if err == nil {
+			l.generation = attrs.Generation
+			return nil
+		}
+		if !errors.Is(wrapErr("Lock", l.name, err), ErrPreconditionFailed) {
+			return wrapErr("Lock", l.name, err)
+		}
+		// another contender took it over first, look at it again
+	}
+}
+
+// renew extends the lease every ttl/3 until done is closed. A write in
+// flight is not interrupted by Unlock, the generation it commits is the one
+// Unlock deletes. A lease which cannot be renewed before it expires, or was
+// taken over, is lost.
+func (l *Lock) renew() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+		l.mu.Lock()
+		generation := l.generation
+		l.mu.Unlock()
+		// a write outlasting the lease is abandoned
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl)
+		attrs, err := l.write(ctx, &Conditions{GenerationMatch: generation})
+		cancel()
+		err = wrapErr("Lock", l.name, err)
+		if err == nil {
+			l.mu.Lock()
+			l.generation = attrs.Generation
+			l.mu.Unlock()
+			renewed = time.Now()
+			continue
+		}
+		select {
+		case <-l.done:
+			return
+		default:
+		}
+		if errors.Is(err, ErrPreconditionFailed) || errors.Is(err, ErrNotExist) || time.Since(renewed) >= l.ttl {
+			l.fail(&Error{Op: "Lock", Object: l.name, Kind: ErrLockLost, Err: err})
+			return
+		}
+	}
+}
+
+// fail records why the lock was lost
+func (l *Lock) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = err
+		close(l.lost)
+	}
+}
+
+// Lost is closed when the lease is lost, work protected by the lock should stop
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err returns why the lock was lost, nil while it is held
+func (l *Lock) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Unlock stops the renewal and deletes the lock object if it is still the
+// generation written by this holder, it returns ErrLockLost otherwise
+func (l *Lock) Unlock() error {
+	return l.UnlockCtx(context.Background())
+}
+
+// UnlockCtx is Unlock with a context
+func (l *Lock) UnlockCtx(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.done) })
+	<-l.stopped
+	if err := l.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	generation := l.generation
+	l.mu.Unlock()
+	err := wrapErr("Unlock", l.name, l.backend.Delete(ctx, l.bucket, l.name, &Conditions{GenerationMatch: generation}))
+	if errors.Is(err, ErrPreconditionFailed) || errors.Is(err, ErrNotExist) {
+		err = &Error{Op: "Unlock", Object: l.name, Kind: ErrLockLost, Err: err}
+		l.fail(err)
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	bucket := newLocalBucket(t)
+	ttl := 300 * time.Millisecond
+	lock, err := bucket.TryLock("locks/cleanup", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.mu.Lock()
+	first := lock.generation
+	lock.mu.Unlock()
+	// the lease outlives its ttl while it is renewed
+	time.Sleep(2 * ttl)
+	if _, err := bucket.TryLock("locks/cleanup", ttl); !errors.Is(err, ErrLocked) {
+		t.Errorf("expecting ErrLocked, got: %v", err)
+	}
+	if lock.Err() != nil {
+		t.Fatalf("expecting the lock to be held, got: %v", lock.Err())
+	}
+	lock.mu.Lock()
+	renewed := lock.generation
+	lock.mu.Unlock()
+	if renewed == first {
+		t.Error("expecting the lease to be renewed")
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	other, err := bucket.TryLock("locks/cleanup", ttl)
+	if err != nil {
+		t.Fatalf("expecting the released lock to be free, got: %v", err)
+	}
+	other.Unlock()
+}
+
+func TestLockStealExpired(t *testing.T) {
+	bucket := newLocalBucket(t)
+	backend, name, _ := bucket.use()
+	expired := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano)
+	_, err := writeObject(context.Background(), backend, name, "lock", strings.NewReader(""), &WriterOptions{
+		Metadata: map[string]string{MetadataLockExpires: expired, MetadataLockHolder: "crashed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := bucket.TryLock("lock", time.Minute)
+	if err != nil {
+		t.Fatalf("expecting the expired lock to be taken over, got: %v", err)
+	}
+	attrs, err := bucket.Attrs("lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Metadata[MetadataLockHolder] != lock.holder {
+		t.Errorf("expecting holder %v, got: %v", lock.holder, attrs.Metadata[MetadataLockHolder])
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	bucket := newLocalBucket(t)
+	lock, err := bucket.TryLock("lock", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another process overwrote the lock object
+	putString(t, bucket, "lock", "")
+	if err := lock.Unlock(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("expecting ErrLockLost, got: %v", err)
+	}
+	if exists, _ := bucket.Exists("lock"); !exists {
+		t.Error("expecting the lock of the other holder to be kept")
+	}
+	select {
+	case <-lock.Lost():
+	default:
+		t.Error("expecting Lost to be closed")
+	}
+}
+
+func TestLockCtx(t *testing.T) {
+	bucket := newLocalBucket(t)
+	lock, err := bucket.TryLock("lock", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := bucket.LockCtx(ctx, "lock", time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("expecting the wait to time out, got: %v", err)
+	}
+}
+
+func TestLockInvalidTTL(t *testing.T) {
+	bucket := newLocalBucket(t)
+	if _, err := bucket.TryLock("lock", 2*time.Nanosecond); err == nil {
+		t.Error("expecting a ttl below 3ns to be rejected")
+	}
+}
+
+// slowWriteBackend signals writing and delays the commit of every write,
+// a write commits even when its context is cancelled meanwhile
+type slowWriteBackend struct {
+	*LocalFSBackend
+	writing chan struct{}
+}
+
+type slowWriter struct {
+	ObjectWriter
+	writing chan struct{}
+}
+
+func (s *slowWriteBackend) NewWriter(ctx context.Context, bucket, object string, opts *WriterOptions) ObjectWriter {
+	return &slowWriter{ObjectWriter: s.LocalFSBackend.NewWriter(context.Background(), bucket, object, opts), writing: s.writing}
+}
+
+func (w *slowWriter) Close() error {
+	select {
+	case w.writing <- struct{}{}:
+	default:
+	}
+	time.Sleep(50 * time.Millisecond)
+	return w.ObjectWriter.Close()
+}
+
+func TestUnlockDuringRenewal(t *testing.T) {
+	backend := &slowWriteBackend{LocalFSBackend: getLocalBackend(t), writing: make(chan struct{}, 1)}
+	bucket := NewBucketWithBackend("local", backend)
+	lock, err := bucket.TryLock("lock", 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the signal of the acquisition, then of the first renewal
+	<-backend.writing
+	<-backend.writing
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("expecting the renewed generation to be unlocked, got: %v", err)
+	}
+	if exists, _ := bucket.Exists("lock"); exists {
+		t.Error("expecting the lock object to be deleted")
+	}
+}
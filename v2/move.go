@@ -0,0 +1,81 @@
+package GCPStorage
+
+import (
+	"context"
+)
+
+// CopyTo copies src of the current bucket to dst in dstBucket. Large objects
+// and copies across locations are rewritten server side in several calls.
+func (b *Bucket) CopyTo(dstBucket, src, dst string) error {
+	return b.CopyToCtx(context.Background(), dstBucket, src, dst)
+}
+
+// CopyToCtx is CopyTo with a context
+func (b *Bucket) CopyToCtx(ctx context.Context, dstBucket, src, dst string) error {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return err
+	}
+	_, err = backend.Copy(ctx, dstBucket, dst, bucket, src, nil)
+	return wrapErr("CopyTo", src, err)
+}
+
+// Move moves src to dst within the current bucket, see MoveTo
+func (b *Bucket) Move(src, dst string) error {
+	return b.MoveToCtx(context.Background(), b.bucketName, src, dst)
+}
+
+// MoveCtx is Move with a context
+func (b *Bucket) MoveCtx(ctx context.Context, src, dst string) error {
+	return b.MoveToCtx(ctx, b.bucketName, src, dst)
+}
+
+// Rename is Move, cloud storage has no rename and copies the object
+func (b *Bucket) Rename(src, dst string) error {
+	return b.Move(src, dst)
+}
+
+// MoveTo copies src of the current bucket to dst in dstBucket then deletes
+// src. The delete only succeeds for the generation of src that was copied, if
+// src is overwritten meanwhile it is kept and the error is
+// ErrPreconditionFailed.
+func (b *Bucket) MoveTo(dstBucket, src, dst string) error {
+	return b.MoveToCtx(context.Background(), dstBucket, src, dst)
+}
+
+// MoveToCtx is MoveTo with a context
+func (b *Bucket) MoveToCtx(ctx context.Context, dstBucket, src, dst string) error {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return err
+	}
+	attrs, err := backend.Attrs(ctx, bucket, src)
+	if err != nil {
+		return wrapErr("Move", src, err)
+	}
+	return moveObject(ctx, backend, dstBucket, dst, bucket, src, attrs.Generation)
+}
+
+// moveObject copies src to dst and deletes generation of src
+func moveObject(ctx context.Context, backend Backend, dstBucket, dst, srcBucket, src string, generation int64) error {
+	if dstBucket == srcBucket && dst == src {
+		return nil
+	}
+	if _, err := backend.Copy(ctx, dstBucket, dst, srcBucket, src, nil); err != nil {
+		return wrapErr("Move", src, err)
+	}
+	return wrapErr("Move", src, backend.Delete(ctx, srcBucket, src, &Conditions{GenerationMatch: generation}))
+}
+
+// MoveFolder moves every object under srcFolder to dstFolder, opts.DstBucket
+// moves them to another bucket. Objects are moved like MoveTo by
+// opts.Workers in parallel. A failed object does not stop the others, the
+// failures are returned together as a *FolderError.
+func (b *Bucket) MoveFolder(srcFolder, dstFolder string, opts CopyFolderOptions) (CopyFolderResult, error) {
+	return b.MoveFolderCtx(context.Background(), srcFolder, dstFolder, opts)
+}
+
+// MoveFolderCtx is MoveFolder with a context
+func (b *Bucket) MoveFolderCtx(ctx context.Context, srcFolder, dstFolder string, opts CopyFolderOptions) (CopyFolderResult, error) {
+	return b.transferFolder(ctx, "MoveFolder", srcFolder, dstFolder, opts, true)
+}
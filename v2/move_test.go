@@ -0,0 +1,60 @@
+package GCPStorage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMove(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "a.txt", "a")
+	if err := bucket.CopyTo("other", "a.txt", "copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.Rename("a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	other := NewBucketWithBackend("other", bucket.Backend())
+	for _, name := range []string{"b.txt", "copy.txt"} {
+		b := bucket
+		if name == "copy.txt" {
+			b = other
+		}
+		if exists, err := b.Exists(name); !exists || err != nil {
+			t.Errorf("expecting %v to exist, got: %v %v", name, exists, err)
+		}
+	}
+	if exists, _ := bucket.Exists("a.txt"); exists {
+		t.Error("expecting a.txt to be moved")
+	}
+	if err := bucket.Move("missing.txt", "c.txt"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("expecting ErrNotExist, got: %v", err)
+	}
+}
+
+func TestMoveFolder(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putTree(t, bucket)
+	result, err := bucket.MoveFolder("dir/", "moved/", CopyFolderOptions{Workers: 4, DstBucket: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Copied != 5 {
+		t.Errorf("expecting 5 objects moved, got: %+v", result)
+	}
+	files, err := NewBucketWithBackend("other", bucket.Backend()).List("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "moved/,moved/a.txt,moved/skip/c.txt,moved/sub/b.txt,moved/z.txt"
+	if strings.Join(files, ",") != want {
+		t.Errorf("expecting %v, got: %v", want, files)
+	}
+	if files, _ := bucket.List("", 0); strings.Join(files, ",") != "root.txt" {
+		t.Errorf("expecting only root.txt left, got: %v", files)
+	}
+	if _, err := bucket.MoveFolder("moved/", "moved/sub/", CopyFolderOptions{}); err == nil {
+		t.Error("expecting an error moving a folder into itself")
+	}
+}
@@ -0,0 +1,86 @@
+package GCPStorage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// UploadFromReaderIf is UploadFromReader when conds hold for dst, it returns
+// the attributes of the new object whose Generation allows a later
+// compare-and-swap. Conditions{DoesNotExist: true} creates dst only if it is
+// absent. When conds do not hold nothing is written and the error is
+// ErrPreconditionFailed.
+func (b *Bucket) UploadFromReaderIf(reader io.Reader, dst string, conds Conditions) (*storage.ObjectAttrs, error) {
+	return b.UploadFromReaderIfCtx(context.Background(), reader, dst, conds)
+}
+
+// UploadFromReaderIfCtx is UploadFromReaderIf with a context
+func (b *Bucket) UploadFromReaderIfCtx(ctx context.Context, reader io.Reader, dst string, conds Conditions) (*storage.ObjectAttrs, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := writeObject(ctx, backend, bucket, dst, reader, &WriterOptions{Conditions: &conds})
+	if err != nil {
+		return nil, wrapErr("UploadFromReader", dst, err)
+	}
+	return attrs, nil
+}
+
+// UploadIf is Upload when conds hold for dst, see UploadFromReaderIf
+func (b *Bucket) UploadIf(localFile, dst string, conds Conditions) (*storage.ObjectAttrs, error) {
+	return b.UploadIfCtx(context.Background(), localFile, dst, conds)
+}
+
+// UploadIfCtx is UploadIf with a context
+func (b *Bucket) UploadIfCtx(ctx context.Context, localFile, dst string, conds Conditions) (*storage.ObjectAttrs, error) {
+	attrs, _, _, err := b.uploadFile(ctx, "Upload", localFile, dst, &WriterOptions{Conditions: &conds})
+	return attrs, err
+}
+
+// CopyFileIf is CopyFile when conds hold for dst, see UploadFromReaderIf
+func (b *Bucket) CopyFileIf(src, dst string, conds Conditions) (*storage.ObjectAttrs, error) {
+	return b.CopyFileIfCtx(context.Background(), src, dst, conds)
+}
+
+// CopyFileIfCtx is CopyFileIf with a context
+func (b *Bucket) CopyFileIfCtx(ctx context.Context, src, dst string, conds Conditions) (*storage.ObjectAttrs, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := backend.Copy(ctx, bucket, dst, bucket, src, &conds)
+	if err != nil {
+		return nil, wrapErr("CopyFile", dst, err)
+	}
+	return attrs, nil
+}
+
+// DeleteIf is Delete when conds hold for filePath, GenerationMatch deletes
+// only the generation that was read. DoesNotExist is not valid for deletes.
+// In trash mode the generation checked against conds is moved to the trash.
+func (b *Bucket) DeleteIf(filePath string, conds Conditions) error {
+	return b.DeleteIfCtx(context.Background(), filePath, conds)
+}
+
+// DeleteIfCtx is DeleteIf with a context
+func (b *Bucket) DeleteIfCtx(ctx context.Context, filePath string, conds Conditions) error {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return err
+	}
+	if b.trashes(filePath) {
+		attrs, err := backend.Attrs(ctx, bucket, filePath)
+		if err != nil {
+			return wrapErr("Delete", filePath, err)
+		}
+		if err := conds.Check(attrs); err != nil {
+			return wrapErr("Delete", filePath, err)
+		}
+		return wrapErr("Delete", filePath, moveToTrash(ctx, backend, bucket, b.trashFolder(time.Now()), attrs))
+	}
+	return wrapErr("Delete", filePath, backend.Delete(ctx, bucket, filePath, &conds))
+}
@@ -0,0 +1,46 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPreconditions(t *testing.T) {
+	ctx := context.Background()
+	bucket := newLocalBucket(t)
+	created, err := bucket.UploadFromReaderIfCtx(ctx, strings.NewReader("v1"), "doc", Conditions{DoesNotExist: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bucket.UploadFromReaderIfCtx(ctx, strings.NewReader("v2"), "doc", Conditions{DoesNotExist: true}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed creating doc twice, got: %v", err)
+	}
+	updated, err := bucket.UploadFromReaderIfCtx(ctx, strings.NewReader("v2"), "doc", Conditions{GenerationMatch: created.Generation})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a writer still holding the first generation loses
+	if _, err := bucket.UploadFromReaderIfCtx(ctx, strings.NewReader("v3"), "doc", Conditions{GenerationMatch: created.Generation}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed on a stale generation, got: %v", err)
+	}
+	if _, err := bucket.UploadIf("testFiles/localfile.txt", "missing", Conditions{GenerationMatch: 1}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed uploading over a missing object, got: %v", err)
+	}
+	if _, err := bucket.CopyFileIfCtx(ctx, "doc", "doc", Conditions{DoesNotExist: true}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed copying over doc, got: %v", err)
+	}
+	if _, err := bucket.CopyFileIf("doc", "copy", Conditions{DoesNotExist: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.DeleteIf("doc", Conditions{GenerationMatch: created.Generation}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed deleting a stale generation, got: %v", err)
+	}
+	if err := bucket.DeleteIfCtx(ctx, "doc", Conditions{GenerationMatch: updated.Generation, MetagenerationMatch: updated.Metageneration}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := bucket.Exists("doc"); exists {
+		t.Error("expecting doc to be deleted")
+	}
+}
@@ -0,0 +1,149 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// ObjectReader reads an object with ranged reads, it implements io.Reader,
+// io.ReaderAt, io.Seeker and io.Closer. ReadAt does not move the offset of
+// Read and can be called concurrently, Read and Seek cannot. With a
+// VersionedBackend every read is pinned to the generation opened, reads of
+// an object replaced or deleted since fail with ErrNotExist.
+type ObjectReader struct {
+	ctx     context.Context
+	backend Backend
+	bucket  string
+	attrs   *storage.ObjectAttrs
+	offset  int64
+	reader  io.ReadCloser
+	closed  bool
+}
+
+// errReaderClosed is returned when using a closed ObjectReader
+var errReaderClosed = errors.New("GCPStorage: reader is closed")
+
+// Open returns a reader of object, nothing is downloaded until it is read
+func (b *Bucket) Open(object string, optionalBucket ...string) (*ObjectReader, error) {
+	return b.OpenCtx(context.Background(), object, optionalBucket...)
+}
+
+// OpenCtx is Open with a context, ctx is used by every read
+func (b *Bucket) OpenCtx(ctx context.Context, object string, optionalBucket ...string) (*ObjectReader, error) {
+	backend, bucket, err := b.use(optionalBucket...)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := backend.Attrs(ctx, bucket, object)
+	if err != nil {
+		return nil, wrapErr("Open", object, err)
+	}
+	return newObjectReader(ctx, backend, bucket, attrs), nil
+}
+
+func newObjectReader(ctx context.Context, backend Backend, bucket string, attrs *storage.ObjectAttrs) *ObjectReader {
+	return &ObjectReader{ctx: ctx, backend: backend, bucket: bucket, attrs: attrs}
+}
+
+// Attrs returns the attributes of the object when it was opened
+func (r *ObjectReader) Attrs() *storage.ObjectAttrs {
+	return r.attrs
+}
+
+// Size returns the size of the object
+func (r *ObjectReader) Size() int64 {
+	return r.attrs.Size
+}
+
+// Read implements io.Reader, the object is streamed from the current offset
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, wrapErr("Read", r.attrs.Name, errReaderClosed)
+	}
+	if r.offset >= r.attrs.Size {
+		return 0, io.EOF
+	}
+	if r.reader == nil {
+		reader, err := newGenerationReader(r.ctx, r.backend, r.bucket, r.attrs.Name, r.attrs.Generation, r.offset, -1)
+		if err != nil {
+			return 0, wrapErr("Read", r.attrs.Name, err)
+		}
+		r.reader = reader
+	}
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	if err != nil && err != io.EOF {
+		err = wrapErr("Read", r.attrs.Name, err)
+	}
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt with a ranged read of len(p) bytes
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if r.closed {
+		return 0, wrapErr("ReadAt", r.attrs.Name, errReaderClosed)
+	}
+	if off < 0 {
+		return 0, wrapErr("ReadAt", r.attrs.Name, errors.New("negative offset"))
+	}
+	if off >= r.attrs.Size {
+		return 0, io.EOF
+	}
+	length := int64(len(p))
+	if off+length > r.attrs.Size {
+		length = r.attrs.Size - off
+	}
+	reader, err := newGenerationReader(r.ctx, r.backend, r.bucket, r.attrs.Name, r.attrs.Generation, off, length)
+	if err != nil {
+		return 0, wrapErr("ReadAt", r.attrs.Name, err)
+	}
+	defer reader.Close()
+	n, err := io.ReadFull(reader, p[:length])
+	if err != nil {
+		return n, wrapErr("ReadAt", r.attrs.Name, err)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Seek implements io.Seeker, the next Read starts a new ranged read
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, wrapErr("Seek", r.attrs.Name, errReaderClosed)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.attrs.Size
+	default:
+		return 0, wrapErr("Seek", r.attrs.Name, errors.New("invalid whence"))
+	}
+	if offset < 0 {
+		return 0, wrapErr("Seek", r.attrs.Name, errors.New("negative offset"))
+	}
+	if offset != r.offset && r.reader != nil {
+		r.reader.Close()
+		r.reader = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close implements io.Closer
+func (r *ObjectReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.reader != nil {
+		return r.reader.Close()
+	}
+	return nil
+}
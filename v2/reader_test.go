@@ -0,0 +1,99 @@
+package GCPStorage
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOpenZip(t *testing.T) {
+	bucket := newLocalBucket(t)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("inner.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("zipped content"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.UploadFromReader(&buf, "archive.zip"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := bucket.Open("archive.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	zr, err := zip.NewReader(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "zipped content" {
+		t.Errorf("expecting zipped content, got: %s", data)
+	}
+}
+
+func TestOpenSeek(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "digits.txt", "0123456789")
+	r, err := bucket.Open("digits.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	p := make([]byte, 4)
+	if n, err := r.ReadAt(p, 8); n != 2 || err != io.EOF || string(p[:n]) != "89" {
+		t.Errorf("expecting 89 and io.EOF, got: %q %v", p[:n], err)
+	}
+	if _, err := r.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "789" {
+		t.Errorf("expecting 789, got: %s", data)
+	}
+	if _, err := r.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r, p); err != nil || string(p) != "2345" {
+		t.Errorf("expecting 2345, got: %q %v", p, err)
+	}
+}
+
+func TestOpenReplaced(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "digits.txt", "0123456789")
+	r, err := bucket.Open("digits.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	putString(t, bucket, "digits.txt", "abc")
+
+	p := make([]byte, 4)
+	if _, err := r.ReadAt(p, 4); !errors.Is(err, ErrNotExist) {
+		t.Errorf("expecting ErrNotExist, got: %v", err)
+	}
+	if _, err := r.Read(p); !errors.Is(err, ErrNotExist) {
+		t.Errorf("expecting ErrNotExist, got: %v", err)
+	}
+}
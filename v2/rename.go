@@ -0,0 +1,177 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// errDstExists is returned by RenameFolder when the destination folder has objects
+var errDstExists = errors.New("GCPStorage: destination folder is not empty")
+
+// RenameFolderResult reports what RenameFolder did, names are the source objects
+type RenameFolderResult struct {
+	// Copied are the objects copied and verified
+	Copied []string
+	// Deleted are the source objects deleted, the renamed ones
+	Deleted []string
+	// RolledBack are the objects whose copy was deleted after a failure, they
+	// are still under the source folder
+	RolledBack []string
+}
+
+// forEach calls fn for the indexes 0 to n-1 using workers goroutines and
+// returns the error of every call, calls are skipped once ctx is done
+func forEach(ctx context.Context, workers, n int, fn func(i int) error) []error {
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, n)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return errs
+}
+
+// RenameFolder moves every object under srcFolder to dstFolder, which must be
+// empty. All objects are copied and their copies checked against the source
+// checksums before any source object is deleted, if a copy fails every copy
+// is deleted and the source is left untouched. Source objects are deleted for
+// the copied generation only, an object which changed or cannot be deleted
+// keeps its source and its copy is deleted. Failures are returned together as
+// a *FolderError along with the result.
+func (b *Bucket) RenameFolder(srcFolder, dstFolder string, opts CopyFolderOptions) (RenameFolderResult, error) {
+	return b.RenameFolderCtx(context.Background(), srcFolder, dstFolder, opts)
+}
+
+// RenameFolderCtx is RenameFolder with a context, the rollback runs even
+// when ctx is cancelled
+func (b *Bucket) RenameFolderCtx(ctx context.Context, srcFolder, dstFolder string, opts CopyFolderOptions) (RenameFolderResult, error) {
+	result := RenameFolderResult{}
+	backend, bucket, err := b.use()
+	if err != nil {
+		return result, err
+	}
+	dstBucket := bucket
+	if opts.DstBucket != "" {
+		dstBucket = opts.DstBucket
+	}
+	srcFolder, dstFolder = dirPrefix(srcFolder), dirPrefix(dstFolder)
+	if err := checkNested(bucket, srcFolder, dstBucket, dstFolder); err != nil {
+		return result, err
+	}
+	it := backend.Objects(ctx, dstBucket, &storage.Query{Prefix: dstFolder})
+	if _, err := it.Next(); err != iterator.Done {
+		if err == nil {
+			err = errDstExists
+		}
+		return result, wrapErr("RenameFolder", dstFolder, err)
+	}
+	srcs := []*storage.ObjectAttrs{}
+	it = backend.Objects(ctx, bucket, &storage.Query{Prefix: srcFolder})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return result, wrapErr("RenameFolder", srcFolder, err)
+		}
+		srcs = append(srcs, attrs)
+	}
+
+	folderErr := &FolderError{Op: "RenameFolder"}
+	copies := make([]*storage.ObjectAttrs, len(srcs))
+	dstName := func(i int) string {
+		return dstFolder + strings.TrimPrefix(srcs[i].Name, srcFolder)
+	}
+	copyErrs := forEach(ctx, opts.Workers, len(srcs), func(i int) error {
+		attrs, err := backend.Copy(ctx, dstBucket, dstName(i), bucket, srcs[i].Name, &Conditions{DoesNotExist: true})
+		if err != nil {
+			return wrapErr("CopyFile", srcs[i].Name, err)
+		}
+		copies[i] = attrs
+		if !sameObject(CompareChecksum, srcs[i], attrs) {
+			return &Error{Op: "RenameFolder", Object: dstName(i), Kind: ErrChecksumMismatch,
+				Err: fmt.Errorf("%w: copy of %s differs", ErrChecksumMismatch, srcs[i].Name)}
+		}
+		return nil
+	})
+	failed := false
+	for i, err := range copyErrs {
+		if err != nil {
+			failed = true
+			folderErr.Errors = append(folderErr.Errors, &ObjectError{Object: srcs[i].Name, Err: err})
+		}
+	}
+
+	deleted := make([]bool, len(srcs))
+	if !failed {
+		deleteErrs := forEach(ctx, opts.Workers, len(srcs), func(i int) error {
+			err := backend.Delete(ctx, bucket, srcs[i].Name, &Conditions{GenerationMatch: srcs[i].Generation})
+			deleted[i] = err == nil
+			return wrapErr("Delete", srcs[i].Name, err)
+		})
+		for i, err := range deleteErrs {
+			if err != nil {
+				folderErr.Errors = append(folderErr.Errors, &ObjectError{Object: srcs[i].Name, Err: err})
+			}
+		}
+	}
+	// the objects still at the source lose their copy
+	rolledBack := make([]bool, len(srcs))
+	rollbackErrs := forEach(context.Background(), opts.Workers, len(srcs), func(i int) error {
+		if deleted[i] || copies[i] == nil {
+			return nil
+		}
+		err := backend.Delete(context.Background(), dstBucket, dstName(i), &Conditions{GenerationMatch: copies[i].Generation})
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return wrapErr("RenameFolder", dstName(i), err)
+		}
+		rolledBack[i] = true
+		return nil
+	})
+	for i, err := range rollbackErrs {
+		if err != nil {
+			folderErr.Errors = append(folderErr.Errors, &ObjectError{Object: srcs[i].Name, Err: err})
+		}
+	}
+	for i := range srcs {
+		if copies[i] != nil && copyErrs[i] == nil {
+			result.Copied = append(result.Copied, srcs[i].Name)
+		}
+		if deleted[i] {
+			result.Deleted = append(result.Deleted, srcs[i].Name)
+		}
+		if rolledBack[i] {
+			result.RolledBack = append(result.RolledBack, srcs[i].Name)
+		}
+	}
+	sort.SliceStable(folderErr.Errors, func(i, j int) bool {
+		return folderErr.Errors[i].(*ObjectError).Object < folderErr.Errors[j].(*ObjectError).Object
+	})
+	return result, folderErr.errOrNil()
+}
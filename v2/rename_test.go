@@ -0,0 +1,88 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+// changingBackend overwrites the source of the copies of the objects in change
+type changingBackend struct {
+	Backend
+	change map[string]bool
+}
+
+func (c *changingBackend) Copy(ctx context.Context, dstBucket, dst, srcBucket, src string, conds *Conditions) (*storage.ObjectAttrs, error) {
+	attrs, err := c.Backend.Copy(ctx, dstBucket, dst, srcBucket, src, conds)
+	if err == nil && c.change[src] {
+		w := c.Backend.NewWriter(ctx, srcBucket, src, nil)
+		w.Write([]byte("changed"))
+		err = w.Close()
+	}
+	return attrs, err
+}
+
+func TestRenameFolder(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putTree(t, bucket)
+	result, err := bucket.RenameFolder("dir", "renamed", CopyFolderOptions{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Copied) != 5 || len(result.Deleted) != 5 || len(result.RolledBack) != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	files, _ := bucket.List("", 0)
+	want := "renamed/,renamed/a.txt,renamed/skip/c.txt,renamed/sub/b.txt,renamed/z.txt,root.txt"
+	if strings.Join(files, ",") != want {
+		t.Errorf("expecting %v, got: %v", want, files)
+	}
+	if _, err := bucket.RenameFolder("renamed", "renamed/sub", CopyFolderOptions{}); err == nil {
+		t.Error("expecting an error renaming a folder into itself")
+	}
+	putString(t, bucket, "other/x.txt", "x")
+	if _, err := bucket.RenameFolder("renamed", "other", CopyFolderOptions{}); err == nil {
+		t.Error("expecting an error renaming to a folder with objects")
+	}
+}
+
+func TestRenameFolderRollback(t *testing.T) {
+	local := getLocalBackend(t)
+	bucket := NewBucketWithBackend("test-bucket", &failingCopyBackend{Backend: local, fail: map[string]bool{"src/b.txt": true}})
+	for _, name := range []string{"src/a.txt", "src/b.txt", "src/c.txt"} {
+		putString(t, bucket, name, name)
+	}
+	result, err := bucket.RenameFolder("src", "dst", CopyFolderOptions{Workers: 2})
+	if err == nil {
+		t.Fatal("expecting the failed copy to be reported")
+	}
+	want := RenameFolderResult{Copied: []string{"src/a.txt", "src/c.txt"}, RolledBack: []string{"src/a.txt", "src/c.txt"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("expecting %+v, got: %+v", want, result)
+	}
+	if files, _ := bucket.List("", 0); strings.Join(files, ",") != "src/a.txt,src/b.txt,src/c.txt" {
+		t.Errorf("expecting the source only, got: %v", files)
+	}
+}
+
+func TestRenameFolderChangedSource(t *testing.T) {
+	local := getLocalBackend(t)
+	bucket := NewBucketWithBackend("test-bucket", &changingBackend{Backend: local, change: map[string]bool{"src/b.txt": true}})
+	for _, name := range []string{"src/a.txt", "src/b.txt"} {
+		putString(t, bucket, name, name)
+	}
+	result, err := bucket.RenameFolder("src", "dst", CopyFolderOptions{})
+	if !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed, got: %v", err)
+	}
+	if !reflect.DeepEqual(result.Deleted, []string{"src/a.txt"}) || !reflect.DeepEqual(result.RolledBack, []string{"src/b.txt"}) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if files, _ := bucket.List("", 0); strings.Join(files, ",") != "dst/a.txt,src/b.txt" {
+		t.Errorf("expecting a.txt renamed and b.txt kept, got: %v", files)
+	}
+}
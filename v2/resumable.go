@@ -0,0 +1,416 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	raw "google.golang.org/api/storage/v1"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// ResumableBackend is implemented by backends supporting resumable upload
+// sessions, a session outlives the process which started it
+type ResumableBackend interface {
+	// StartResumable starts a session uploading size bytes to object and returns its URI.
+	StartResumable(ctx context.Context, bucket, object string, size int64, opts *WriterOptions) (string, error)
+	// ResumableStatus returns the number of bytes committed in session, and
+	// the attributes of the object once the upload is complete.
+	ResumableStatus(ctx context.Context, session string, size int64) (int64, *storage.ObjectAttrs, error)
+	// WriteResumable sends data at offset and returns the committed offset,
+	// the chunk ending at size completes the upload and returns the object attributes.
+	WriteResumable(ctx context.Context, session string, offset, size int64, data []byte) (int64, *storage.ObjectAttrs, error)
+}
+
+var _ ResumableBackend = (*GCSBackend)(nil)
+
+// ResumableChunkAlign is the granularity of resumable chunks, chunk sizes are rounded up to it
+const ResumableChunkAlign = 256 << 10
+
+// DefaultResumableChunkSize is the chunk size of UploadResumable
+const DefaultResumableChunkSize = 16 << 20
+
+// ResumableOptions configure UploadResumable
+type ResumableOptions struct {
+	// ChunkSize is the amount of data sent per request, rounded up to a
+	// multiple of ResumableChunkAlign, zero uses DefaultResumableChunkSize.
+	// A crash loses at most one chunk.
+	ChunkSize int
+	// StatePath is the file recording the session, it defaults to
+	// localFile + ".upload" and is removed when the upload completes
+	StatePath   string
+	ContentType string
+	Metadata    map[string]string
+}
+
+// resumableState is the content of the state file of a resumable upload
+type resumableState struct {
+	Bucket  string    `json:"bucket"`
+	Object  string    `json:"object"`
+	Session string    `json:"session"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Offset  int64     `json:"offset"`
+}
+
+// loadState reads the JSON state file path into state, it reports whether
+// there was a readable state
+func loadState(path string, state interface{}) bool {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, state) == nil
+}
+
+// saveState writes state as JSON next to path and renames it so a crash
+// never leaves a partial state
+func saveState(path string, state interface{}) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// UploadResumable uploads localFile to dst in chunks through a resumable
+// session. The session and the committed offset are saved in a state file
+// so running it again after the process was killed continues the upload
+// where it stopped. The uploaded object is checked like UploadVerify.
+func (b *Bucket) UploadResumable(localFile, dst string, opts ResumableOptions) error {
+	return b.UploadResumableCtx(context.Background(), localFile, dst, opts)
+}
+
+// UploadResumableCtx is UploadResumable with a context, cancelling ctx keeps
+// the state for a later resume
+func (b *Bucket) UploadResumableCtx(ctx context.Context, localFile, dst string, opts ResumableOptions) error {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return err
+	}
+	resumable, ok := backend.(ResumableBackend)
+	if !ok {
+		return ErrNotSupported
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultResumableChunkSize
+	}
+	opts.ChunkSize = (opts.ChunkSize + ResumableChunkAlign - 1) / ResumableChunkAlign * ResumableChunkAlign
+	if opts.StatePath == "" {
+		opts.StatePath = localFile + ".upload"
+	}
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	md5sum, crc, err := fileChecksums(file)
+	if err != nil {
+		return err
+	}
+
+	state := &resumableState{}
+	if !loadState(opts.StatePath, state) {
+		state = nil
+	}
+	var attrs *storage.ObjectAttrs
+	if state != nil && state.Bucket == bucket && state.Object == dst && state.Size == info.Size() && state.ModTime.Equal(info.ModTime()) {
+		state.Offset, attrs, err = resumable.ResumableStatus(ctx, state.Session, state.Size)
+		if err != nil {
+			if !expiredSession(err) {
+				return wrapErr("UploadResumable", dst, err)
+			}
+			state = nil
+		}
+	} else {
+		state = nil
+	}
+	if state == nil {
+		session, err := resumable.StartResumable(ctx, bucket, dst, info.Size(), &WriterOptions{
+			ContentType: opts.ContentType,
+			Metadata:    opts.Metadata,
+		})
+		if err != nil {
+			return wrapErr("UploadResumable", dst, err)
+		}
+		state = &resumableState{Bucket: bucket, Object: dst, Session: session, Size: info.Size(), ModTime: info.ModTime()}
+	}
+	if err := saveState(opts.StatePath, state); err != nil {
+		return err
+	}
+
+	buf := make([]byte, opts.ChunkSize)
+	for attrs == nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := file.ReadAt(buf, state.Offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		state.Offset, attrs, err = resumable.WriteResumable(ctx, state.Session, state.Offset, state.Size, buf[:n])
+		if err != nil {
+			return wrapErr("UploadResumable", dst, err)
+		}
+		if err := saveState(opts.StatePath, state); err != nil {
+			return err
+		}
+	}
+	os.Remove(opts.StatePath)
+	return verifyChecksums("UploadResumable", dst, attrs, md5sum, crc)
+}
+
+// expiredSession reports whether a resumable session is gone and the upload must restart
+func expiredSession(err error) bool {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return true
+	}
+	apiErr := &googleapi.Error{}
+	return errors.As(err, &apiErr) && (apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusGone)
+}
+
+// fileChecksums returns the MD5 and CRC32C of the content of file
+func fileChecksums(file io.ReadSeeker) ([]byte, uint32, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	md5Hash := md5.New()
+	crcHash := crc32.New(crc32cTable)
+	if _, err := io.Copy(io.MultiWriter(md5Hash, crcHash), file); err != nil {
+		return nil, 0, err
+	}
+	return md5Hash.Sum(nil), crcHash.Sum32(), nil
+}
+
+// verifyChecksums compares the checksums of an uploaded object with the local ones,
+// objects without MD5 (composite objects) are compared by CRC32C
+func verifyChecksums(op, object string, attrs *storage.ObjectAttrs, md5sum []byte, crc uint32) error {
+	var err error
+	switch {
+	case len(attrs.MD5) > 0 && !bytes.Equal(attrs.MD5, md5sum):
+		err = fmt.Errorf("%w: local md5 %x, remote md5 %x", ErrChecksumMismatch, md5sum, attrs.MD5)
+	case len(attrs.MD5) == 0 && attrs.CRC32C != crc:
+		err = fmt.Errorf("%w: local crc32c %08x, remote crc32c %08x", ErrChecksumMismatch, crc, attrs.CRC32C)
+	}
+	if err != nil {
+		return &Error{Op: op, Object: object, Kind: ErrChecksumMismatch, Err: err}
+	}
+	return nil
+}
+
+// uploadClient returns the authenticated client used for resumable sessions
+// and rewrites, see SetHTTPClient
+func (g *GCSBackend) uploadClient() (*http.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.httpClient != nil {
+		return g.httpClient, nil
+	}
+	opts := append([]option.ClientOption{option.WithScopes(storage.ScopeFullControl)}, g.clientOpts...)
+	if g.emulator {
+		opts = append(opts, option.WithoutAuthentication())
+	}
+	// the client outlives the request which created it
+	client, _, err := htransport.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	g.httpClient = client
+	return client, nil
+}
+
+// apiRoot returns the root URL of the JSON API, e.g.
+// "https://storage.googleapis.com/". It is the endpoint of the client options
+// given to NewBucket or NewBucketAt, the Endpoint of emulators and of
+// backends created by NewGCSBackend.
+func (g *GCSBackend) apiRoot() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.apiURL != "" {
+		return g.apiURL, nil
+	}
+	if g.emulator || g.clientOpts == nil {
+		return g.endpoint + "/", nil
+	}
+	// the service only resolves the endpoint of the options, it sends nothing
+	opts := append(append([]option.ClientOption(nil), g.clientOpts...), option.WithHTTPClient(http.DefaultClient))
+	service, err := raw.NewService(context.Background(), opts...)
+	if err != nil {
+		return "", err
+	}
+	g.apiURL = strings.TrimSuffix(service.BasePath, "storage/v1/")
+	return g.apiURL, nil
+}
+
+// StartResumable implements ResumableBackend with the resumable upload protocol of the JSON API
+func (g *GCSBackend) StartResumable(ctx context.Context, bucket, object string, size int64, opts *WriterOptions) (string, error) {
+	client, err := g.uploadClient()
+	if err != nil {
+		return "", err
+	}
+	if opts == nil {
+		opts = &WriterOptions{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"name":        object,
+		"contentType": opts.ContentType,
+		"metadata":    opts.Metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+	root, err := g.apiRoot()
+	if err != nil {
+		return "", err
+	}
+	u := root + "upload/storage/v1/b/" + url.PathEscape(bucket) + "/o?uploadType=resumable&name=" + url.QueryEscape(object)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	if opts.ContentType != "" {
+		req.Header.Set("X-Upload-Content-Type", opts.ContentType)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return "", err
+	}
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return "", errors.New("GCPStorage: resumable session without location")
+	}
+	return session, nil
+}
+
+// ResumableStatus implements ResumableBackend
+func (g *GCSBackend) ResumableStatus(ctx context.Context, session string, size int64) (int64, *storage.ObjectAttrs, error) {
+	return g.resumablePut(ctx, session, "bytes */"+strconv.FormatInt(size, 10), size, nil)
+}
+
+// WriteResumable implements ResumableBackend
+func (g *GCSBackend) WriteResumable(ctx context.Context, session string, offset, size int64, data []byte) (int64, *storage.ObjectAttrs, error) {
+	end := offset + int64(len(data))
+	total := "*"
+	if end == size {
+		total = strconv.FormatInt(size, 10)
+	}
+	contentRange := fmt.Sprintf("bytes %d-%d/%s", offset, end-1, total)
+	if len(data) == 0 {
+		contentRange = "bytes */" + total
+	}
+	return g.resumablePut(ctx, session, contentRange, size, data)
+}
+
+// resumablePut sends a chunk or a status query to session, 308 means the
+// upload is incomplete and its Range header holds the committed bytes
+func (g *GCSBackend) resumablePut(ctx context.Context, session, contentRange string, size int64, data []byte) (int64, *storage.ObjectAttrs, error) {
+	client, err := g.uploadClient()
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Range", contentRange)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPermanentRedirect {
+		committed := resp.Header.Get("Range")
+		if committed == "" {
+			return 0, nil, nil
+		}
+		i := strings.LastIndex(committed, "-")
+		last, err := strconv.ParseInt(committed[i+1:], 10, 64)
+		if i < 0 || err != nil {
+			return 0, nil, fmt.Errorf("GCPStorage: invalid committed range %q", committed)
+		}
+		return last + 1, nil, nil
+	}
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return 0, nil, err
+	}
+	obj := objectResource{}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return 0, nil, err
+	}
+	attrs, err := obj.objectAttrs()
+	return size, attrs, err
+}
+
+// objectResource is the JSON API representation of an object
+type objectResource struct {
+	Bucket         string            `json:"bucket"`
+	Name           string            `json:"name"`
+	ContentType    string            `json:"contentType"`
+	Metadata       map[string]string `json:"metadata"`
+	Size           int64             `json:"size,string"`
+	MD5Hash        string            `json:"md5Hash"`
+	CRC32C         string            `json:"crc32c"`
+	Generation     int64             `json:"generation,string"`
+	Metageneration int64             `json:"metageneration,string"`
+	TimeCreated    time.Time         `json:"timeCreated"`
+	Updated        time.Time         `json:"updated"`
+}
+
+func (o *objectResource) objectAttrs() (*storage.ObjectAttrs, error) {
+	md5sum, err := base64.StdEncoding.DecodeString(o.MD5Hash)
+	if err != nil {
+		return nil, err
+	}
+	// the CRC32C is missing from some responses, e.g. of emulators
+	var crc uint32
+	if o.CRC32C != "" {
+		data, err := base64.StdEncoding.DecodeString(o.CRC32C)
+		if err != nil || len(data) != 4 {
+			return nil, fmt.Errorf("GCPStorage: invalid crc32c %q", o.CRC32C)
+		}
+		crc = binary.BigEndian.Uint32(data)
+	}
+	return &storage.ObjectAttrs{
+		Bucket:         o.Bucket,
+		Name:           o.Name,
+		ContentType:    o.ContentType,
+		Metadata:       o.Metadata,
+		Size:           o.Size,
+		MD5:            md5sum,
+		CRC32C:         crc,
+		Generation:     o.Generation,
+		Metageneration: o.Metageneration,
+		Created:        o.TimeCreated,
+		Updated:        o.Updated,
+	}, nil
+}
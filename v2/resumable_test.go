@@ -0,0 +1,137 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// interruptedBackend fails the chunk write number failAt
+type interruptedBackend struct {
+	*LocalFSBackend
+	writes int
+	failAt int
+}
+
+func (i *interruptedBackend) WriteResumable(ctx context.Context, session string, offset, size int64, data []byte) (int64, *storage.ObjectAttrs, error) {
+	i.writes++
+	if i.writes == i.failAt {
+		return 0, nil, errors.New("killed")
+	}
+	return i.LocalFSBackend.WriteResumable(ctx, session, offset, size, data)
+}
+
+func TestUploadResumable(t *testing.T) {
+	backend := &interruptedBackend{LocalFSBackend: getLocalBackend(t), failAt: 3}
+	bucket := NewBucketWithBackend("local", backend)
+	content := bytes.Repeat([]byte("resumable"), 100000)
+	localFile := writeTempFile(t, content)
+	opts := ResumableOptions{ChunkSize: 1, ContentType: "text/plain"}
+
+	if err := bucket.UploadResumable(localFile, "big.txt", opts); err == nil {
+		t.Fatal("expecting the interrupted upload to fail")
+	}
+	if _, err := os.Stat(localFile + ".upload"); err != nil {
+		t.Fatalf("expecting a state file, got: %v", err)
+	}
+	backend.writes, backend.failAt = 0, -1
+	if err := bucket.UploadResumable(localFile, "big.txt", opts); err != nil {
+		t.Fatal(err)
+	}
+	// 900000 bytes in chunks of 256 KiB, two were committed before the failure
+	if backend.writes != 2 {
+		t.Errorf("expecting 2 chunks on resume, got: %v", backend.writes)
+	}
+	reader, err := bucket.GetFileReader("big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("uploaded content does not match")
+	}
+	if _, err := os.Stat(localFile + ".upload"); !os.IsNotExist(err) {
+		t.Errorf("expecting the state file to be removed, got: %v", err)
+	}
+}
+
+// resumableServer serves the resumable upload protocol of the JSON API for a single session
+func resumableServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	var data []byte
+	var name string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/bkt/o") {
+			name = r.URL.Query().Get("name")
+			w.Header().Set("Location", server.URL+"/session")
+			return
+		}
+		if r.Method != http.MethodPut || r.URL.Path != "/session" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var start, end, total int64
+		contentRange := r.Header.Get("Content-Range")
+		if n, _ := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total); n >= 2 {
+			data = append(data[:start], body...)
+		} else {
+			fmt.Sscanf(contentRange, "bytes */%d", &total)
+		}
+		if total == 0 || int64(len(data)) < total {
+			if len(data) > 0 {
+				w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(data)-1))
+			}
+			w.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		md5sum := md5.Sum(data)
+		crc := make([]byte, 4)
+		binary.BigEndian.PutUint32(crc, crc32.Checksum(data, crc32cTable))
+		json.NewEncoder(w).Encode(map[string]string{
+			"bucket":     "bkt",
+			"name":       name,
+			"size":       fmt.Sprint(len(data)),
+			"md5Hash":    base64.StdEncoding.EncodeToString(md5sum[:]),
+			"crc32c":     base64.StdEncoding.EncodeToString(crc),
+			"generation": "1",
+		})
+	}))
+	return server
+}
+
+func TestGCSUploadResumable(t *testing.T) {
+	server := resumableServer(t)
+	defer server.Close()
+	bucket, err := NewBucketAt(context.Background(), "bkt", server.URL, option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bucket.Close()
+	content := bytes.Repeat([]byte("gcs"), 200000)
+	if err := bucket.UploadResumable(writeTempFile(t, content), "file.bin", ResumableOptions{ChunkSize: ResumableChunkAlign}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// maxRewriteAttempts is the number of times a failed rewrite call is sent
+// again with the last rewrite token before the copy fails
+const maxRewriteAttempts = 3
+
+// rewriteResponse is the JSON API response of objects.rewrite
+type rewriteResponse struct {
+	Done         bool            `json:"done"`
+	RewriteToken string          `json:"rewriteToken"`
+	Resource     *objectResource `json:"resource"`
+}
+
+// rewrite copies srcBucket/src to dstBucket/dst server side, srcGeneration
+// selects a generation of src and 0 the live one. Large objects and
+// copies across locations or storage classes take several calls, each call
+// continues from the token of the previous one and a failed call is resumed
+// from the last token instead of starting over. storage.Copier does not send
+// the token again, so it restarts the copy on every call.
+func (g *GCSBackend) rewrite(ctx context.Context, dstBucket, dst, srcBucket, src string, srcGeneration int64, opts *CopyOptions) (*storage.ObjectAttrs, error) {
+	client, err := g.uploadClient()
+	if err != nil {
+		return nil, err
+	}
+	root, err := g.apiRoot()
+	if err != nil {
+		return nil, err
+	}
+	u := root + "storage/v1/b/" + url.PathEscape(srcBucket) + "/o/" + url.PathEscape(src) +
+		"/rewriteTo/b/" + url.PathEscape(dstBucket) + "/o/" + url.PathEscape(dst)
+	query := opts.conditions().query()
+	body := []byte("{}")
+	if opts != nil && opts.Metadata != nil {
+		// a resource in the body replaces every attribute of the copy, the
+		// others are taken from the generation of src being copied
+		obj := g.client.Bucket(srcBucket).Object(src)
+		if srcGeneration != 0 {
+			obj = obj.Generation(srcGeneration)
+		}
+		attrs, err := obj.Attrs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		srcGeneration = attrs.Generation
+		body, err = json.Marshal(rewriteResource{
+			ContentType:        attrs.ContentType,
+			ContentEncoding:    attrs.ContentEncoding,
+			ContentLanguage:    attrs.ContentLanguage,
+			ContentDisposition: attrs.ContentDisposition,
+			CacheControl:       attrs.CacheControl,
+			Metadata:           opts.Metadata,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if srcGeneration != 0 {
+		query.Set("sourceGeneration", strconv.FormatInt(srcGeneration, 10))
+	}
+	token := ""
+	failures := 0
+	for {
+		if token != "" {
+			query.Set("rewriteToken", token)
+		}
+		res, err := rewriteCall(ctx, client, u, query, body)
+		if err != nil {
+			failures++
+			if ctx.Err() != nil || failures == maxRewriteAttempts || !retryableRewrite(err) {
+				return nil, err
+			}
+			continue
+		}
+		failures = 0
+		if res.Done {
+			if res.Resource == nil {
+				return nil, errRewriteResource
+			}
+			return res.Resource.objectAttrs()
+		}
+		token = res.RewriteToken
+	}
+}
+
+// rewriteResource are the attributes of the copy sent with objects.rewrite
+type rewriteResource struct {
+	ContentType        string            `json:"contentType,omitempty"`
+	ContentEncoding    string            `json:"contentEncoding,omitempty"`
+	ContentLanguage    string            `json:"contentLanguage,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	Metadata           map[string]string `json:"metadata"`
+}
+
+// errRewriteResource is returned when a finished rewrite has no object
+var errRewriteResource = errors.New("GCPStorage: rewrite finished without an object")
+
+// retryableRewrite reports whether a failed rewrite call may be sent again
+func retryableRewrite(err error) bool {
+	var e *googleapi.Error
+	if errors.As(err, &e) {
+		return e.Code == http.StatusTooManyRequests || e.Code >= http.StatusInternalServerError
+	}
+	// network errors
+	return true
+}
+
+// query returns the JSON API parameters of c, DoesNotExist is generation 0
+func (c *Conditions) query() url.Values {
+	query := url.Values{}
+	if c == nil {
+		return query
+	}
+	if c.DoesNotExist {
+		query.Set("ifGenerationMatch", "0")
+	} else if c.GenerationMatch != 0 {
+		query.Set("ifGenerationMatch", strconv.FormatInt(c.GenerationMatch, 10))
+	}
+	if c.MetagenerationMatch != 0 {
+		query.Set("ifMetagenerationMatch", strconv.FormatInt(c.MetagenerationMatch, 10))
+	}
+	return query
+}
+
+func rewriteCall(ctx context.Context, client *http.Client, u string, query url.Values, body []byte) (*rewriteResponse, error) {
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	res := &rewriteResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,163 @@
+package GCPStorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+func TestGCSCopyResumesRewrite(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("rewriteToken")
+		calls = append(calls, token)
+		switch {
+		case token == "" && len(calls) == 1:
+			fmt.Fprint(w, `{"done": false, "rewriteToken": "t1", "totalBytesRewritten": "1", "objectSize": "2"}`)
+		case token == "t1" && len(calls) == 2:
+			http.Error(w, `{"error": {"code": 503, "message": "unavailable"}}`, http.StatusServiceUnavailable)
+		case token == "t1":
+			fmt.Fprint(w, `{"done": true, "totalBytesRewritten": "2", "objectSize": "2", "resource": {"bucket": "dst", "name": "b.bin", "size": "2", "crc32c": "AAAAAA=="}}`)
+		default:
+			http.Error(w, "unexpected rewrite", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	bucket, err := NewBucketAt(context.Background(), "src", server.URL, option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bucket.Close()
+	attrs, err := bucket.Backend().Copy(context.Background(), "dst", "b.bin", "src", "a.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Size != 2 || strings.Join(calls, ",") != ",t1,t1" {
+		t.Errorf("expecting the rewrite to resume from t1, got: %v %v", attrs.Size, calls)
+	}
+}
+
+func TestGCSCopyGeneration(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, `{"done": true, "resource": {"bucket": "b", "name": "doc", "generation": "9", "crc32c": "AAAAAA=="}}`)
+	}))
+	defer server.Close()
+	bucket, err := NewBucketAt(context.Background(), "b", server.URL, option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bucket.Close()
+	attrs, err := bucket.RestoreVersion("doc", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("sourceGeneration") != "7" || attrs.Generation != 9 {
+		t.Errorf("expecting generation 7 to be copied, got: %v %v", query, attrs.Generation)
+	}
+}
+
+func TestGCSCopyMetadata(t *testing.T) {
+	var body map[string]interface{}
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if r.URL.Query().Get("generation") != "5" {
+				http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"bucket": "b", "name": "doc", "generation": "5", "contentType": "text/plain", "metadata": {"k": "v"}}`)
+			return
+		}
+		query = r.URL.Query()
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"done": true, "resource": {"bucket": "b", "name": "copy", "generation": "6", "crc32c": "AAAAAA=="}}`)
+	}))
+	defer server.Close()
+	bucket, err := NewBucketAt(context.Background(), "b", server.URL, option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bucket.Close()
+	_, err = bucket.Backend().(*GCSBackend).CopyGeneration(context.Background(), "b", "copy", "b", "doc", 5, &CopyOptions{Metadata: map[string]string{"k": "new"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body["contentType"] != "text/plain" || fmt.Sprint(body["metadata"]) != "map[k:new]" || query.Get("sourceGeneration") != "5" {
+		t.Errorf("expecting the attributes of generation 5 with the new metadata, got: %v %v", body, query)
+	}
+}
+
+// headerTransport adds header to every request
+type headerTransport struct {
+	header, value string
+}
+
+func (h *headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(h.header, h.value)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestGCSCopyHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer caller" {
+			http.Error(w, `{"error": {"code": 401, "message": "unauthorized"}}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"done": true, "resource": {"bucket": "b", "name": "copy", "crc32c": "AAAAAA=="}}`)
+	}))
+	defer server.Close()
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := NewGCSBackend(client)
+	defer backend.Close()
+	backend.SetEndpoint(server.URL)
+	backend.SetHTTPClient(&http.Client{Transport: &headerTransport{header: "Authorization", value: "Bearer caller"}})
+	if _, err := backend.Copy(context.Background(), "b", "copy", "b", "doc", nil); err != nil {
+		t.Fatalf("expecting the copy to be sent with the client set, got: %v", err)
+	}
+}
+
+func TestRetryableRewrite(t *testing.T) {
+	if retryableRewrite(fmt.Errorf("rewrite: %w", &googleapi.Error{Code: http.StatusBadRequest})) {
+		t.Error("expecting a wrapped bad request not to be retried")
+	}
+	if !retryableRewrite(fmt.Errorf("rewrite: %w", &googleapi.Error{Code: http.StatusServiceUnavailable})) {
+		t.Error("expecting a wrapped unavailable error to be retried")
+	}
+}
+
+func TestGCSCopyClientEndpoint(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		// no crc32c, like some emulators
+		fmt.Fprint(w, `{"done": true, "resource": {"bucket": "b", "name": "copy", "size": "4"}}`)
+	}))
+	defer server.Close()
+	bucket, err := NewBucket(context.Background(), "b", option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bucket.Close()
+	attrs, err := bucket.Backend().Copy(context.Background(), "b", "copy", "b", "doc", nil)
+	if err != nil {
+		t.Fatalf("expecting the copy to be sent to the endpoint of the options, got: %v", err)
+	}
+	if path != "/storage/v1/b/b/o/doc/rewriteTo/b/b/o/copy" || attrs.Size != 4 {
+		t.Errorf("unexpected rewrite %v: %+v", path, attrs)
+	}
+}
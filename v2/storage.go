@@ -8,24 +8,98 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"regexp"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
 	humanize "github.com/dustin/go-humanize"
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
-	raw "google.golang.org/api/storage/v1"
 )
 
+// Bucket is a handle to a cloud storage bucket. All operations on a Bucket
+// share one Backend, create it with NewBucket and release it with Close.
 type Bucket struct {
 	bucketName string
+	backend    Backend
+	err        error
+	// trash is the folder deleted objects are moved to, see SetTrash
+	trash string
+}
+
+// NewBucket creates a Bucket backed by a single long-lived storage client,
+// opts are passed to storage.NewClient.
+func NewBucket(ctx context.Context, name string, opts ...option.ClientOption) (*Bucket, error) {
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	backend := NewGCSBackend(client)
+	backend.clientOpts = opts
+	return NewBucketWithBackend(name, backend), nil
+}
+
+// NewBucketAt is NewBucket for a storage API served at endpoint, for example
+// an emulator such as fake-gcs-server at "http://localhost:4443". Signed and
+// public URLs point to endpoint as well. Emulators usually need
+// option.WithoutAuthentication() in opts.
+func NewBucketAt(ctx context.Context, name, endpoint string, opts ...option.ClientOption) (*Bucket, error) {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	opts = append([]option.ClientOption{option.WithEndpoint(endpoint + "/storage/v1/")}, opts...)
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	backend := NewGCSBackend(client)
+	backend.clientOpts = opts
+	backend.SetEndpoint(endpoint)
+	return NewBucketWithBackend(name, backend), nil
+}
+
+// NewBucketWithBackend creates a Bucket named name stored in backend
+func NewBucketWithBackend(name string, backend Backend) *Bucket {
+	return &Bucket{bucketName: name, backend: backend}
+}
+
+// Name returns the name of the bucket
+func (b *Bucket) Name() string {
+	return b.bucketName
+}
+
+// Backend returns the backend the bucket is stored in
+func (b *Bucket) Backend() Backend {
+	return b.backend
+}
+
+// Close releases the backend owned by the bucket.
+func (b *Bucket) Close() error {
+	if b.backend == nil {
+		return nil
+	}
+	return b.backend.Close()
+}
+
+// use returns the backend and the bucket name to use, optionalBucket overrides the current bucket
+func (b *Bucket) use(optionalBucket ...string) (Backend, string, error) {
+	if b.err != nil {
+		return nil, "", b.err
+	}
+	if b.backend == nil {
+		return nil, "", errors.New("GCPStorage: bucket is not initialized, use NewBucket or Init")
+	}
+	useBucket := b.bucketName
+	if len(optionalBucket) == 1 {
+		useBucket = optionalBucket[0]
+	}
+	return b.backend, useBucket, nil
 }
 
 func MD5fileBytes(url string) (hash []byte, err error) {
@@ -60,41 +134,54 @@ type Meta struct {
 	LastUpdate  time.Time
 	Created     time.Time
 	ContentType string
+	// Generation identifies the content, it changes on every write
+	Generation int64
 }
 
 //export GOOGLE_APPLICATION_CREDENTIALS="/home/user/Downloads/[FILE_NAME].json"
 
-// Init storage instance
+// Init storage instance with a client using the default credentials,
+// prefer NewBucket which reports client errors directly
 func (b *Bucket) Init(bucket string) {
 	b.bucketName = bucket
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.backend = NewGCSBackend(client)
 }
 
 // GetFolderSize gets the size in bytes of a folder in the bucket
 func (b *Bucket) GetFolderSize(prefix string) (int64, error) {
-	ctx := context.Background()
+	return b.GetFolderSizeCtx(context.Background(), prefix)
+}
 
-	// Create a client.
-	client, err := storage.NewClient(ctx)
+// GetFolderSizeCtx is GetFolderSize with a context
+func (b *Bucket) GetFolderSizeCtx(ctx context.Context, prefix string) (int64, error) {
+	backend, bucket, err := b.use()
 	if err != nil {
 		return 0, err
 	}
-	defer client.Close()
 
 	// Initialize total size variable
 	var totalSize int64
 
 	// Create a query to list objects with the specified prefix
 	query := &storage.Query{Prefix: prefix}
-	it := client.Bucket(b.bucketName).Objects(ctx, query)
+	it := backend.Objects(ctx, bucket, query)
 
 	// Iterate over the objects and sum their sizes
 	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
 		objAttrs, err := it.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return 0, err
+			return 0, wrapErr("GetFolderSize", prefix, err)
 		}
 		totalSize += objAttrs.Size
 	}
@@ -102,268 +189,469 @@ func (b *Bucket) GetFolderSize(prefix string) (int64, error) {
 	return totalSize, nil
 }
 
+// DefaultCopyWorkers is the number of parallel copies CopyFolder makes when multiple is true
+const DefaultCopyWorkers = 16
+
+// CopyFolderOptions configure CopyFolderWithOptions
+type CopyFolderOptions struct {
+	// Workers is the number of objects copied in parallel, at least one
+	Workers int
+	// DstBucket is the bucket of the destination folder, empty uses the current bucket
+	DstBucket string
+}
+
+// CopyFolderResult reports what a folder copy did
+type CopyFolderResult struct {
+	Copied int
+	Failed int
+	// Bytes is the size of the copied objects
+	Bytes int64
+}
+
 // CopyFolder copy cloud storage folder to another dst
 func (b *Bucket) CopyFolder(srcFolder, dstFolder string, multiple bool) error {
-	ctx := context.Background()
-	// get readonly client
-	client, err := storage.NewClient(ctx)
+	return b.CopyFolderCtx(context.Background(), srcFolder, dstFolder, multiple)
+}
+
+// CopyFolderCtx is CopyFolder with a context
+func (b *Bucket) CopyFolderCtx(ctx context.Context, srcFolder, dstFolder string, multiple bool) error {
+	opts := CopyFolderOptions{Workers: 1}
+	if multiple {
+		opts.Workers = DefaultCopyWorkers
+	}
+	_, err := b.CopyFolderWithOptionsCtx(ctx, srcFolder, dstFolder, opts)
+	return err
+}
+
+// CopyFolderWithOptions copies every object under srcFolder to dstFolder using
+// opts.Workers parallel copies. A failed object does not stop the others, the
+// failures are returned together as a *FolderError.
+func (b *Bucket) CopyFolderWithOptions(srcFolder, dstFolder string, opts CopyFolderOptions) (CopyFolderResult, error) {
+	return b.CopyFolderWithOptionsCtx(context.Background(), srcFolder, dstFolder, opts)
+}
+
+// CopyFolderWithOptionsCtx is CopyFolderWithOptions with a context, no copy
+// is started once ctx is done
+func (b *Bucket) CopyFolderWithOptionsCtx(ctx context.Context, srcFolder, dstFolder string, opts CopyFolderOptions) (CopyFolderResult, error) {
+	return b.transferFolder(ctx, "CopyFolder", srcFolder, dstFolder, opts, false)
+}
+
+// transferFolder copies the objects under srcFolder to dstFolder, with move
+// each source object is deleted once copied, provided it did not change
+func (b *Bucket) transferFolder(ctx context.Context, op, srcFolder, dstFolder string, opts CopyFolderOptions, move bool) (CopyFolderResult, error) {
+	result := CopyFolderResult{}
+	backend, bucket, err := b.use()
 	if err != nil {
-		return err
+		return result, err
+	}
+	dstBucket := bucket
+	if opts.DstBucket != "" {
+		dstBucket = opts.DstBucket
 	}
-	defer client.Close()
-	bucket := client.Bucket(b.bucketName)
-	it := bucket.Objects(ctx, &storage.Query{
+	if move {
+		if err := checkNested(bucket, srcFolder, dstBucket, dstFolder); err != nil {
+			return result, err
+		}
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	folderErr := &FolderError{Op: op}
+	mu := sync.Mutex{}
+	jobs := make(chan *storage.ObjectAttrs)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for attrs := range jobs {
+				dst := dstFolder + strings.TrimPrefix(attrs.Name, srcFolder)
+				var err error
+				if move {
+					err = moveObject(ctx, backend, dstBucket, dst, bucket, attrs.Name, attrs.Generation)
+				} else {
+					_, err = backend.Copy(ctx, dstBucket, dst, bucket, attrs.Name, nil)
+					err = wrapErr("CopyFile", attrs.Name, err)
+				}
+				mu.Lock()
+				if err != nil {
+					result.Failed++
+					folderErr.Errors = append(folderErr.Errors, &ObjectError{Object: attrs.Name, Err: err})
+				} else {
+					result.Copied++
+					result.Bytes += attrs.Size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	it := backend.Objects(ctx, bucket, &storage.Query{
 		Prefix: srcFolder,
 	})
-	wg := sync.WaitGroup{}
-	errs := []error{}
+	var listErr error
 	for {
-
+		if listErr = ctx.Err(); listErr != nil {
+			break
+		}
 		attrs, err := it.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
-
-		pat := regexp.MustCompile("^(.*?)" + srcFolder + "(.*)$")
-		repl := "${1}" + dstFolder + "$2"
-
-		dst := pat.ReplaceAllString(attrs.Name, repl)
-		if multiple {
-			wg.Add(1)
-			go func() {
-				err = b.CopyFile(attrs.Name, dst)
-				errs = append(errs, err)
-				wg.Done()
-			}()
-
-		} else {
-			err = b.CopyFile(attrs.Name, dst)
-			if err != nil {
-				return err
-			}
+		if err != nil {
+			listErr = err
+			break
 		}
-
+		jobs <- attrs
 	}
-	if multiple {
-		wg.Wait()
-		for i := range errs {
-			if errs[i] != nil {
-				return err
-			}
-		}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(folderErr.Errors, func(i, j int) bool {
+		return folderErr.Errors[i].(*ObjectError).Object < folderErr.Errors[j].(*ObjectError).Object
+	})
+	if listErr != nil {
+		folderErr.Errors = append(folderErr.Errors, wrapErr(op, srcFolder, listErr))
 	}
-	return err
+	return result, folderErr.errOrNil()
 }
 
 // CopyFile copy cloud storage file to another dst
 func (b *Bucket) CopyFile(src, dst string) error {
+	return b.CopyFileCtx(context.Background(), src, dst)
+}
 
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+// CopyFileCtx is CopyFile with a context
+func (b *Bucket) CopyFileCtx(ctx context.Context, src, dst string) error {
+	backend, bucket, err := b.use()
 	if err != nil {
 		return err
 	}
-	defer client.Close()
-	bucket := client.Bucket(b.bucketName)
-	srcFile := bucket.Object(src)
-	dstFile := bucket.Object(dst)
 	// Just copy content.
-	_, err = dstFile.CopierFrom(srcFile).Run(ctx)
+	_, err = backend.Copy(ctx, bucket, dst, bucket, src, nil)
 	if err != nil {
-		return err
+		return wrapErr("CopyFile", src, err)
 	}
 	return nil
 }
 
 // UploadFromReader upload from reader to GCP file
 func (b *Bucket) UploadFromReader(reader io.Reader, dst string, optionalBucket ...string) error {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+	return b.UploadFromReaderCtx(context.Background(), reader, dst, optionalBucket...)
+}
+
+// UploadFromReaderCtx is UploadFromReader with a context, cancelling ctx aborts the upload
+func (b *Bucket) UploadFromReaderCtx(ctx context.Context, reader io.Reader, dst string, optionalBucket ...string) error {
+	backend, bucket, err := b.use(optionalBucket...)
 	if err != nil {
 		return err
 	}
-	defer client.Close()
-	useBucket := b.bucketName
-	if len(optionalBucket) == 1 {
-		useBucket = optionalBucket[0]
+	_, err = writeObject(ctx, backend, bucket, dst, reader, nil)
+	return wrapErr("UploadFromReader", dst, err)
+}
+
+// writeObject streams reader into object computing its CRC32C. With
+// opts.SendCRC32C the backend checks the data itself, otherwise the CRC32C of
+// the committed object is compared with the one of the data sent and a
+// corrupted object is deleted, unless it was replaced in the meantime.
+func writeObject(ctx context.Context, backend Backend, bucket, object string, reader io.Reader, opts *WriterOptions) (*storage.ObjectAttrs, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	crc := crc32.New(crc32cTable)
+	w := backend.NewWriter(ctx, bucket, object, opts)
+	if _, err := io.Copy(w, io.TeeReader(reader, crc)); err != nil {
+		cancel()
+		w.Close()
+		return nil, err
 	}
-	bucket := client.Bucket(useBucket)
-	wc := bucket.Object(dst).NewWriter(ctx)
-	if _, err = io.Copy(wc, reader); err != nil {
-		return err
+	if err := w.Close(); err != nil {
+		return nil, err
 	}
-	return wc.Close()
+	attrs := w.Attrs()
+	if attrs != nil && attrs.CRC32C != crc.Sum32() {
+		backend.Delete(ctx, bucket, object, &Conditions{GenerationMatch: attrs.Generation})
+		return attrs, fmt.Errorf("%w: local crc32c %08x, remote crc32c %08x", ErrChecksumMismatch, crc.Sum32(), attrs.CRC32C)
+	}
+	return attrs, nil
 }
 
 // GetSignedURL get signed url with expire time
 func (b *Bucket) GetSignedURL(objectPath string, duration time.Duration, optionalBucket ...string) (string, error) {
-	ctx := context.Background()
-	cre, err := google.FindDefaultCredentials(ctx)
+	return b.GetSignedURLCtx(context.Background(), objectPath, duration, optionalBucket...)
+}
+
+// GetSignedURLCtx is GetSignedURL with a context
+func (b *Bucket) GetSignedURLCtx(ctx context.Context, objectPath string, duration time.Duration, optionalBucket ...string) (string, error) {
+	backend, bucket, err := b.use(optionalBucket...)
 	if err != nil {
 		return "", err
 	}
-	conf, err := google.JWTConfigFromJSON(cre.JSON)
-	if conf == nil {
-		return "", errors.New("Error getting Default Credentials")
+	urls, ok := backend.(URLBackend)
+	if !ok {
+		return "", ErrNotSupported
 	}
+	signedURL, err := urls.SignedURL(ctx, bucket, objectPath, time.Now().Add(duration))
+	return signedURL, wrapErr("GetSignedURL", objectPath, err)
+}
+
+// Upload local file to the current bucket
+func (b *Bucket) Upload(localFile, dst string) error {
+	return b.UploadCtx(context.Background(), localFile, dst)
+}
+
+// UploadCtx is Upload with a context, the CRC32C of the file is sent along
+// so corrupted uploads are rejected
+func (b *Bucket) UploadCtx(ctx context.Context, localFile, dst string) error {
+	_, _, _, err := b.uploadFile(ctx, "Upload", localFile, dst, nil)
+	return err
+}
+
+// uploadFile uploads localFile with its CRC32C and returns the attributes of
+// the object and the checksums of the file, opts may be nil
+func (b *Bucket) uploadFile(ctx context.Context, op, localFile, dst string, opts *WriterOptions) (attrs *storage.ObjectAttrs, md5sum []byte, crc uint32, err error) {
+	backend, bucket, err := b.use()
 	if err != nil {
-		return "", err
+		return nil, nil, 0, err
 	}
-	opts := &storage.SignedURLOptions{
-		Scheme:         storage.SigningSchemeV4,
-		Method:         "GET",
-		GoogleAccessID: conf.Email,
-		PrivateKey:     conf.PrivateKey,
-		Expires:        time.Now().Add(duration),
-	}
-	useBucket := b.bucketName
-	if len(optionalBucket) == 1 {
-		useBucket = optionalBucket[0]
+	file, err := os.Open(localFile)
+	if err != nil {
+		return nil, nil, 0, err
 	}
-	signedURL, err := storage.SignedURL(useBucket, objectPath, opts)
+	defer file.Close()
+	md5sum, crc, err = fileChecksums(file)
 	if err != nil {
-		return "", err
+		return nil, nil, 0, err
 	}
-	return signedURL, nil
-}
-
-// Upload local file to the current bucket
-func (b *Bucket) Upload(localFile, dst string) error {
-	fileReader, err := os.Open(localFile)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, 0, err
+	}
+	writerOpts := WriterOptions{}
+	if opts != nil {
+		writerOpts = *opts
+	}
+	writerOpts.CRC32C, writerOpts.SendCRC32C = crc, true
+	attrs, err = writeObject(ctx, backend, bucket, dst, file, &writerOpts)
 	if err != nil {
-		return err
+		return nil, nil, 0, wrapErr(op, dst, err)
 	}
-	defer fileReader.Close()
-	return b.UploadFromReader(fileReader, dst)
+	return attrs, md5sum, crc, nil
 }
 
 // UploadVerify local file to the current bucket and perform checksum after uploading
 func (b *Bucket) UploadVerify(localFile, dst string) error {
-	localMD5, err := MD5file(localFile)
-	if err != nil {
-		return err
-	}
-	err = b.Upload(localFile, dst)
-	if err != nil {
-		return err
-	}
-	remoteMD5, err := b.MD5(dst)
+	return b.UploadVerifyCtx(context.Background(), localFile, dst)
+}
+
+// UploadVerifyCtx is UploadVerify with a context. The object is checked
+// against the MD5 of the file, or its CRC32C for objects without MD5 like
+// composite objects.
+func (b *Bucket) UploadVerifyCtx(ctx context.Context, localFile, dst string) error {
+	attrs, md5sum, crc, err := b.uploadFile(ctx, "UploadVerify", localFile, dst, nil)
 	if err != nil {
 		return err
 	}
-	if remoteMD5 != localMD5 {
-		return errors.New("UploadVerify: local and remote md5 didnt match")
-	}
-	return nil
+	return verifyChecksums("UploadVerify", dst, attrs, md5sum, crc)
 }
 
 // GetMeta get size
 func (b *Bucket) GetMeta(src string, optionalBucket ...string) (Meta, error) {
+	return b.GetMetaCtx(context.Background(), src, optionalBucket...)
+}
+
+// GetMetaCtx is GetMeta with a context
+func (b *Bucket) GetMetaCtx(ctx context.Context, src string, optionalBucket ...string) (Meta, error) {
 	meta := Meta{}
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+	backend, bucket, err := b.use(optionalBucket...)
 	if err != nil {
 		return meta, err
 	}
-	defer client.Close()
-	useBucket := b.bucketName
-	if len(optionalBucket) == 1 {
-		useBucket = optionalBucket[0]
-	}
-	bucket := client.Bucket(useBucket)
-	attrs, err := bucket.Object(src).Attrs(ctx)
+	attrs, err := backend.Attrs(ctx, bucket, src)
 	if err != nil {
 		//log.Println(err)
-		return meta, err
+		return meta, wrapErr("GetMeta", src, err)
 	}
 	meta.MD5 = base64.StdEncoding.EncodeToString(attrs.MD5)
 	meta.Size = attrs.Size
 	meta.SizeStr = humanize.Bytes(uint64(meta.Size))
 	meta.Created = attrs.Created
 	meta.ContentType = attrs.ContentType
+	meta.Generation = attrs.Generation
 	return meta, nil
 }
 
-// Exists check if file exists
+// Exists check if file exists, a missing file is not an error
 func (b *Bucket) Exists(filePath string) (bool, error) {
-	md5, err := b.MD5(filePath)
+	return b.ExistsCtx(context.Background(), filePath)
+}
+
+// ExistsCtx is Exists with a context
+func (b *Bucket) ExistsCtx(ctx context.Context, filePath string) (bool, error) {
+	_, err := b.AttrsCtx(ctx, filePath)
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
-	if md5 != "" {
-		return true, nil
-	}
-	return false, errors.New("could not get checksum of the file")
+	return true, nil
 }
 
 // List all files in a bucket with a prefix
 // prefix can be a folder, if prefix is empty string the function will return all files in the bucket
 // limit is number of files to retrive, 0 means all
 func (b *Bucket) List(prefix string, limit int) (files []string, err error) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx, option.WithScopes(raw.DevstorageReadOnlyScope))
-	if err != nil {
-		return nil, err
-	}
-	q := &storage.Query{
-		Prefix: prefix,
-	}
-	if prefix == "" {
-		q = nil
-	}
+	return b.ListCtx(context.Background(), prefix, limit)
+}
+
+// ListCtx is List with a context, listing errors are returned
+func (b *Bucket) ListCtx(ctx context.Context, prefix string, limit int) (files []string, err error) {
 	files = []string{}
-	it := client.Bucket(b.bucketName).Objects(ctx, q)
-	for {
+	it := b.Objects(ctx, Query{Prefix: prefix})
+	for limit <= 0 || len(files) < limit {
 		attrs, err := it.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			break
+			return nil, err
 		}
 		files = append(files, attrs.Name)
-		if len(files) > limit && limit > 0 {
-			break
-		}
 	}
-	return
-
+	return files, nil
 }
 
-// GetFileReader get file reader from gcp bucket
+// GetFileReader get file reader from gcp bucket, the reader is an io.ReadCloser
+// the caller should close, see Open for ranged and random access reads.
+// Reading to the end checks the CRC32C of the object, a mismatch is
+// reported as ErrChecksumMismatch instead of io.EOF.
 func (b *Bucket) GetFileReader(object string, optionalBucket ...string) (reader io.Reader, err error) {
-	ctx := context.Background()
-	// get readonly client
-	client, err := storage.NewClient(ctx, option.WithScopes(raw.DevstorageReadOnlyScope))
+	return b.GetFileReaderCtx(context.Background(), object, optionalBucket...)
+}
+
+// GetFileReaderCtx is GetFileReader with a context, the reader stops when ctx is cancelled
+func (b *Bucket) GetFileReaderCtx(ctx context.Context, object string, optionalBucket ...string) (reader io.Reader, err error) {
+	return b.newReader(ctx, object, optionalBucket...)
+}
+
+// newReader opens object for reading, the caller closes the reader
+func (b *Bucket) newReader(ctx context.Context, object string, optionalBucket ...string) (io.ReadCloser, error) {
+	backend, bucket, err := b.use(optionalBucket...)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer client.Close()
-	useBucket := b.bucketName
-	if len(optionalBucket) == 1 {
-		useBucket = optionalBucket[0]
+	reader, attrs, err := openObject(ctx, backend, bucket, object)
+	if err != nil {
+		return nil, wrapErr("NewReader", object, err)
+	}
+	return newChecksumReader(reader, attrs), nil
+}
+
+// newGenerationReader reads generation of object from backends keeping
+// generations, other backends read the live object
+func newGenerationReader(ctx context.Context, backend Backend, bucket, object string, generation, offset, length int64) (io.ReadCloser, error) {
+	if versions, ok := backend.(VersionedBackend); ok {
+		return versions.NewGenerationReader(ctx, bucket, object, generation, offset, length)
 	}
-	return client.Bucket(useBucket).Object(object).NewReader(ctx)
+	return backend.NewRangeReader(ctx, bucket, object, offset, length)
 }
 
-// Delete storage file from the current bucket
+// openObject returns a reader of the live generation of object and its
+// attributes. The read is pinned to the generation of the attributes, an
+// object replaced in between is opened again.
+func openObject(ctx context.Context, backend Backend, bucket, object string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	for {
+		attrs, err := backend.Attrs(ctx, bucket, object)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader, err := newGenerationReader(ctx, backend, bucket, object, attrs.Generation, 0, -1)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, attrs, nil
+	}
+}
+
+// newChecksumReader checks the data of reader against the CRC32C of attrs.
+// Objects stored with gzip content encoding are served decompressed and
+// cannot be checked.
+func newChecksumReader(reader io.ReadCloser, attrs *storage.ObjectAttrs) io.ReadCloser {
+	if attrs.ContentEncoding == "gzip" {
+		return reader
+	}
+	return &checksumReader{reader: reader, crc: crc32.New(crc32cTable), want: attrs.CRC32C, object: attrs.Name}
+}
+
+// checksumReader checks the CRC32C of an object once it is read to the end
+type checksumReader struct {
+	reader io.ReadCloser
+	crc    hash.Hash32
+	want   uint32
+	object string
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.crc.Write(p[:n])
+	if err == io.EOF && r.crc.Sum32() != r.want {
+		return n, &Error{
+			Op:     "Read",
+			Object: r.object,
+			Kind:   ErrChecksumMismatch,
+			Err:    fmt.Errorf("%w: read crc32c %08x, object crc32c %08x", ErrChecksumMismatch, r.crc.Sum32(), r.want),
+		}
+	}
+	return n, err
+}
+
+func (r *checksumReader) Close() error {
+	return r.reader.Close()
+}
+
+// Delete storage file from the current bucket, in trash mode it is moved to
+// the trash, see SetTrash
 func (b *Bucket) Delete(filePath string) error {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+	return b.DeleteCtx(context.Background(), filePath)
+}
+
+// DeleteCtx is Delete with a context
+func (b *Bucket) DeleteCtx(ctx context.Context, filePath string) error {
+	backend, bucket, err := b.use()
 	if err != nil {
 		return err
 	}
-	defer client.Close()
-	bucket := client.Bucket(b.bucketName)
-	return bucket.Object(filePath).Delete(ctx)
+	return b.deleteObject(ctx, backend, bucket, filePath)
+}
+
+// deleteObject deletes filePath of bucket, or moves it to the trash when
+// bucket is the one of b and trash mode is on
+func (b *Bucket) deleteObject(ctx context.Context, backend Backend, bucket, filePath string) error {
+	if bucket == b.bucketName && b.trashes(filePath) {
+		attrs, err := backend.Attrs(ctx, bucket, filePath)
+		if err != nil {
+			return wrapErr("Delete", filePath, err)
+		}
+		return wrapErr("Delete", filePath, moveToTrash(ctx, backend, bucket, b.trashFolder(time.Now()), attrs))
+	}
+	return wrapErr("Delete", filePath, backend.Delete(ctx, bucket, filePath, nil))
 }
 
 // ReadFile into object
 func (b *Bucket) ReadFile(filepath string, obj interface{}) (err error) {
-	reader, err := b.GetFileReader(filepath)
+	return b.ReadFileCtx(context.Background(), filepath, obj)
+}
+
+// ReadFileCtx is ReadFile with a context
+func (b *Bucket) ReadFileCtx(ctx context.Context, filepath string, obj interface{}) (err error) {
+	reader, err := b.newReader(ctx, filepath)
 	if err != nil {
 		return
 	}
+	defer reader.Close()
 	data, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return
@@ -373,7 +661,23 @@ func (b *Bucket) ReadFile(filepath string, obj interface{}) (err error) {
 
 // Download file from source (src) to local destination (dst)
 func (b *Bucket) Download(src, dst string) error {
-	reader, err := b.GetFileReader(src)
+	return b.DownloadCtx(context.Background(), src, dst)
+}
+
+// DownloadCtx is Download with a context, cancelling ctx stops the transfer.
+// The CRC32C of the data is checked, dst is removed if it does not match.
+func (b *Bucket) DownloadCtx(ctx context.Context, src, dst string) error {
+	reader, err := b.newReader(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return downloadTo(reader, dst)
+}
+
+// downloadTo writes reader to the local file dst, dst is removed if the
+// checksum of the data does not match
+func downloadTo(reader io.Reader, dst string) error {
 	dstFile, err := os.Create(dst)
 	if err != nil {
 		return err
@@ -381,80 +685,115 @@ func (b *Bucket) Download(src, dst string) error {
 	defer dstFile.Close()
 
 	_, err = io.Copy(dstFile, reader)
-	if err != nil {
-		return err
+	if errors.Is(err, ErrChecksumMismatch) {
+		dstFile.Close()
+		os.Remove(dst)
 	}
-	return nil
+	return err
 }
 
 // Attrs returns the metadata for the bucket.
 func (b *Bucket) Attrs(filePath string) (attrs *storage.ObjectAttrs, err error) {
-	ctx := context.Background()
-	// get readonly client
-	client, err := storage.NewClient(ctx, option.WithScopes(raw.DevstorageReadOnlyScope))
+	return b.AttrsCtx(context.Background(), filePath)
+}
+
+// AttrsCtx is Attrs with a context
+func (b *Bucket) AttrsCtx(ctx context.Context, filePath string) (attrs *storage.ObjectAttrs, err error) {
+	backend, bucket, err := b.use()
 	if err != nil {
 		return
 	}
-	defer client.Close()
-	bucket := client.Bucket(b.bucketName)
 	// [START get_metadata]
-	o := bucket.Object(filePath)
-	return o.Attrs(ctx)
+	attrs, err = backend.Attrs(ctx, bucket, filePath)
+	return attrs, wrapErr("Attrs", filePath, err)
 }
 
-// DeleteFolder delete all files under folder
+// DeleteFolder delete all files under folder, see SetTrash for trash mode
 func (b *Bucket) DeleteFolder(folder string) error {
-	ctx := context.Background()
-	// get readonly client
-	client, err := storage.NewClient(ctx)
+	return b.DeleteFolderCtx(context.Background(), folder)
+}
+
+// DeleteFolderCtx is DeleteFolder with a context, ctx is checked between objects
+func (b *Bucket) DeleteFolderCtx(ctx context.Context, folder string) error {
+	backend, bucket, err := b.use()
 	if err != nil {
 		return err
 	}
-	defer client.Close()
-	bucket := client.Bucket(b.bucketName)
-	it := bucket.Objects(ctx, &storage.Query{
+	it := backend.Objects(ctx, bucket, &storage.Query{
 		Prefix: folder,
 	})
+	trash := b.trashes(folder)
+	trashFolder := b.trashFolder(time.Now())
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		attrs, err := it.Next()
-		if err != nil {
+		if err == iterator.Done {
 			return nil
 		}
+		if err != nil {
+			return wrapErr("DeleteFolder", folder, err)
+		}
 
-		err = bucket.Object(attrs.Name).Delete(ctx)
+		switch {
+		case !trash:
+			err = backend.Delete(ctx, bucket, attrs.Name, nil)
+		case !b.trashes(attrs.Name):
+			continue
+		default:
+			if err = moveToTrash(ctx, backend, bucket, trashFolder, attrs); trashSkipped(err) {
+				err = nil
+			}
+		}
 		if err != nil {
-			return err
+			return wrapErr("Delete", attrs.Name, err)
 		}
 	}
-	return nil
 }
 
-// DeleteOldFiles delete files from folder based on their age, time from created date
+// DeleteOldFiles delete files from folder based on their age, time from created date,
+// see SetTrash for trash mode
 func (b *Bucket) DeleteOldFiles(folder string, fileAge time.Duration) error {
-	ctx := context.Background()
-	// get readonly client
-	client, err := storage.NewClient(ctx)
+	return b.DeleteOldFilesCtx(context.Background(), folder, fileAge)
+}
+
+// DeleteOldFilesCtx is DeleteOldFiles with a context, ctx is checked between objects
+func (b *Bucket) DeleteOldFilesCtx(ctx context.Context, folder string, fileAge time.Duration) error {
+	backend, bucket, err := b.use()
 	if err != nil {
 		return err
 	}
-	defer client.Close()
-	bucket := client.Bucket(b.bucketName)
-	it := bucket.Objects(ctx, &storage.Query{
+	it := backend.Objects(ctx, bucket, &storage.Query{
 		Prefix: folder,
 	})
 	now := time.Now()
+	trash := b.trashes(folder)
+	trashFolder := b.trashFolder(now)
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		attrs, err := it.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return err
+			return wrapErr("DeleteOldFiles", folder, err)
+		}
+		if trash && !b.trashes(attrs.Name) {
+			continue
 		}
 		if diff := now.Sub(attrs.Created); diff > fileAge {
-			err = bucket.Object(attrs.Name).Delete(ctx)
+			if trash {
+				if err = moveToTrash(ctx, backend, bucket, trashFolder, attrs); trashSkipped(err) {
+					err = nil
+				}
+			} else {
+				err = backend.Delete(ctx, bucket, attrs.Name, nil)
+			}
 			if err != nil {
-				return err
+				return wrapErr("Delete", attrs.Name, err)
 			}
 		}
 	}
@@ -463,7 +802,12 @@ func (b *Bucket) DeleteOldFiles(folder string, fileAge time.Duration) error {
 
 // Size get the size of the file in int64
 func (b *Bucket) Size(filePath string) (size int64, err error) {
-	attrs, err := b.Attrs(filePath)
+	return b.SizeCtx(context.Background(), filePath)
+}
+
+// SizeCtx is Size with a context
+func (b *Bucket) SizeCtx(ctx context.Context, filePath string) (size int64, err error) {
+	attrs, err := b.AttrsCtx(ctx, filePath)
 	if err != nil {
 		return
 	}
@@ -473,23 +817,32 @@ func (b *Bucket) Size(filePath string) (size int64, err error) {
 
 // MakePublic make file public (readonly) and retrive the download url
 func (b *Bucket) MakePublic(filePath string) (downloadURL string, err error) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+	return b.MakePublicCtx(context.Background(), filePath)
+}
+
+// MakePublicCtx is MakePublic with a context
+func (b *Bucket) MakePublicCtx(ctx context.Context, filePath string) (downloadURL string, err error) {
+	backend, bucket, err := b.use()
 	if err != nil {
 		return "", err
 	}
-	defer client.Close()
-	bucket := client.Bucket(b.bucketName)
-	acl := bucket.Object(filePath).ACL()
-	if err := acl.Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
-		return "", err
+	urls, ok := backend.(URLBackend)
+	if !ok {
+		return "", ErrNotSupported
 	}
-	return "https://storage.googleapis.com/" + b.bucketName + "/" + filePath, nil
+	downloadURL, err = urls.MakePublic(ctx, bucket, filePath)
+	return downloadURL, wrapErr("MakePublic", filePath, err)
 }
 
 // MD5 get the md5 checksum of a file in a bucket
 func (b *Bucket) MD5(filePath string) (md5String string, err error) {
-	attrs, err := b.Attrs(filePath)
+	return b.MD5Ctx(context.Background(), filePath)
+}
+
+// MD5Ctx is MD5 with a context, objects without MD5 such as composite
+// objects fail with ErrNoMD5
+func (b *Bucket) MD5Ctx(ctx context.Context, filePath string) (md5String string, err error) {
+	attrs, err := b.AttrsCtx(ctx, filePath)
 	if err != nil {
 		return
 	}
@@ -497,16 +850,23 @@ func (b *Bucket) MD5(filePath string) (md5String string, err error) {
 	if md5String != "" {
 		return
 	}
-	err = errors.New("could not get md5 of the file")
+	err = &Error{Op: "MD5", Object: filePath, Kind: ErrNoMD5, Err: ErrNoMD5}
 	return
 }
 
 // UploadFromURL streams a file from a public HTTPS URL directly into GCP Storage without saving locally.
 func (b *Bucket) UploadFromURL(fileURL, dst string, optionalBucket ...string) error {
-	ctx := context.Background()
+	return b.UploadFromURLCtx(context.Background(), fileURL, dst, optionalBucket...)
+}
 
+// UploadFromURLCtx is UploadFromURL with a context, used for both the download and the upload
+func (b *Bucket) UploadFromURLCtx(ctx context.Context, fileURL, dst string, optionalBucket ...string) error {
 	// Make HTTP request
-	resp, err := http.Get(fileURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch file from URL: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to fetch file from URL: %w", err)
 	}
@@ -516,29 +876,16 @@ func (b *Bucket) UploadFromURL(fileURL, dst string, optionalBucket ...string) er
 		return fmt.Errorf("non-200 response from file URL: %s", resp.Status)
 	}
 
-	// Initialize GCP storage client
-	client, err := storage.NewClient(ctx)
+	// Choose target bucket
+	backend, bucket, err := b.use(optionalBucket...)
 	if err != nil {
 		return err
 	}
-	defer client.Close()
-
-	// Choose target bucket
-	useBucket := b.bucketName
-	if len(optionalBucket) == 1 {
-		useBucket = optionalBucket[0]
-	}
-
-	// Create writer for the destination file
-	writer := client.Bucket(useBucket).Object(dst).NewWriter(ctx)
-	writer.ContentType = resp.Header.Get("Content-Type")
-	writer.ChunkSize = 0 // Use internal buffering
 
 	// Stream from response to GCS writer
-	if _, err := io.Copy(writer, resp.Body); err != nil {
-		writer.CloseWithError(err)
-		return err
-	}
-
-	return writer.Close()
+	_, err = writeObject(ctx, backend, bucket, dst, resp.Body, &WriterOptions{
+		ContentType: resp.Header.Get("Content-Type"),
+		ChunkSize:   -1, // Single request without buffering
+	})
+	return wrapErr("UploadFromURL", dst, err)
 }
@@ -1,11 +1,18 @@
 package GCPStorage
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"cloud.google.com/go/storage"
 )
 
 func readURL(httpURL string) (string, error) {
@@ -20,20 +27,50 @@ func readURL(httpURL string) (string, error) {
 	}
 	return string(data), nil
 }
-func getBucket() Bucket {
+
+// getBucket returns the bucket named by GOOGLE_CLOUD_BUCKET. With
+// STORAGE_EMULATOR_HOST set the bucket is created on the emulator, without
+// either variable the bucket is stored in a temporary directory and served
+// by a local test server.
+func getBucket(t *testing.T) *Bucket {
+	ctx := context.Background()
 	bucketName := os.Getenv("GOOGLE_CLOUD_BUCKET")
+	if os.Getenv("STORAGE_EMULATOR_HOST") != "" {
+		if bucketName == "" {
+			bucketName = "test-bucket"
+		}
+		bucket, err := NewBucket(ctx, bucketName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// emulators start empty, an error means the bucket already exists
+		bucket.Backend().(*GCSBackend).Client().Bucket(bucketName).Create(ctx, "test-project", nil)
+		t.Cleanup(func() { bucket.Close() })
+		return bucket
+	}
 	if bucketName == "" {
-		panic("Environment variable 'GOOGLE_CLOUD_BUCKET' was not set")
+		bucket, err := NewLocalBucket(t.TempDir(), "test-bucket")
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend := bucket.Backend().(*LocalFSBackend)
+		server := httptest.NewServer(backend.Handler())
+		t.Cleanup(server.Close)
+		backend.SetEndpoint(server.URL)
+		return bucket
+	}
+	bucket, err := NewBucket(ctx, bucketName)
+	if err != nil {
+		t.Fatal(err)
 	}
-	bucket := Bucket{}
-	bucket.Init(bucketName)
+	t.Cleanup(func() { bucket.Close() })
 	return bucket
 }
 
 func TestUploadDeleteExists(t *testing.T) {
 	src := "testFiles/localfile.txt"
 	dst := "tempFile.txt"
-	bucket := getBucket()
+	bucket := getBucket(t)
 	err := bucket.Upload(src, dst)
 	if err != nil {
 		t.Error(err)
@@ -63,13 +100,16 @@ func TestGetSignedURL(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	bucket := getBucket()
+	bucket := getBucket(t)
 	err = bucket.Upload(src, dst)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer bucket.Delete(dst)
 	signedURL, err := bucket.GetSignedURL(dst, time.Second*3)
+	if err != nil {
+		t.Fatal(err)
+	}
 	dstData, err := readURL(signedURL)
 	if err != nil {
 		t.Fatal(err)
@@ -77,6 +117,10 @@ func TestGetSignedURL(t *testing.T) {
 	if string(dstData) != string(sourceFile) {
 		t.Fatal("Remote file does not match local file")
 	}
+	if os.Getenv("STORAGE_EMULATOR_HOST") != "" {
+		// emulator urls are not signed and do not expire
+		return
+	}
 	time.Sleep(6 * time.Second)
 	dstData, err = readURL(signedURL)
 	if err == nil && string(dstData) == string(sourceFile) {
@@ -87,7 +131,7 @@ func TestDownload(t *testing.T) {
 	src := "testFiles/localfile.txt"
 	dst := "tempFile.txt"
 	temp := "./tempFile.txt"
-	bucket := getBucket()
+	bucket := getBucket(t)
 	err := bucket.Upload(src, dst)
 	if err != nil {
 		t.Error(err)
@@ -106,7 +150,7 @@ func TestDownload(t *testing.T) {
 func TestMD5(t *testing.T) {
 	src := "testFiles/localfile.txt"
 	dst := "tempFile.txt"
-	bucket := getBucket()
+	bucket := getBucket(t)
 	err := bucket.Upload(src, dst)
 	if err != nil {
 		t.Error(err)
@@ -126,6 +170,19 @@ func TestMD5(t *testing.T) {
 	}
 
 }
+func TestMD5Composite(t *testing.T) {
+	bucket := NewBucketWithBackend("test-bucket", getLocalBackend(t))
+	if err := bucket.UploadFromReader(strings.NewReader("data"), "part.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bucket.Backend().Compose(context.Background(), "test-bucket", "composite.txt", []string{"part.txt", "part.txt"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bucket.MD5("composite.txt"); !errors.Is(err, ErrNoMD5) {
+		t.Errorf("expecting ErrNoMD5, got: %v", err)
+	}
+}
+
 func TestMD5File(t *testing.T) {
 	src := "testFiles/localfile.txt"
 	md5, err := MD5file(src)
@@ -140,7 +197,7 @@ func TestMD5File(t *testing.T) {
 func TestSize(t *testing.T) {
 	src := "testFiles/localfile.txt"
 	dst := "tempFile.txt"
-	bucket := getBucket()
+	bucket := getBucket(t)
 	err := bucket.Upload(src, dst)
 	if err != nil {
 		t.Error(err)
@@ -166,7 +223,7 @@ func TestCopyFolder(t *testing.T) {
 	dstFolder := "testFiles_dst"
 	src := srcFolder + "/localfile.txt"
 	dst := dstFolder + "/tempFile.txt"
-	bucket := getBucket()
+	bucket := getBucket(t)
 	err := bucket.Upload(src, dst)
 	if err != nil {
 		t.Error(err)
@@ -185,11 +242,15 @@ func TestCopyFolder(t *testing.T) {
 }
 
 func TestUploadFromURL(t *testing.T) {
-	bucket := getBucket()
+	bucket := getBucket(t)
 	dst := "uploadFromURL/test-file.jpg"
-	url := "https://via.placeholder.com/150" // Small image for testing
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("not really a jpeg"))
+	}))
+	defer server.Close()
 
-	err := bucket.UploadFromURL(url, dst)
+	err := bucket.UploadFromURL(server.URL, dst)
 	if err != nil {
 		t.Fatalf("UploadFromURL failed: %v", err)
 	}
@@ -206,3 +267,64 @@ func TestUploadFromURL(t *testing.T) {
 		t.Fatal("Uploaded file from URL does not exist in bucket")
 	}
 }
+
+func TestDeleteFolderCtxCancelled(t *testing.T) {
+	bucket := getBucket(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := bucket.DeleteFolderCtx(ctx, "testFiles")
+	if err != context.Canceled {
+		t.Fatalf("expecting context.Canceled, got: %v", err)
+	}
+}
+
+// failingCopyBackend fails copies of the objects in fail
+type failingCopyBackend struct {
+	Backend
+	fail map[string]bool
+}
+
+func (f *failingCopyBackend) Copy(ctx context.Context, dstBucket, dst, srcBucket, src string, conds *Conditions) (*storage.ObjectAttrs, error) {
+	if f.fail[src] {
+		return nil, errors.New("copy failed")
+	}
+	return f.Backend.Copy(ctx, dstBucket, dst, srcBucket, src, conds)
+}
+
+func TestCopyFolderWithOptions(t *testing.T) {
+	local := getLocalBackend(t)
+	backend := &failingCopyBackend{Backend: local, fail: map[string]bool{"src/03.txt": true, "src/07.txt": true}}
+	bucket := NewBucketWithBackend("test-bucket", backend)
+	for i := 0; i < 10; i++ {
+		err := bucket.UploadFromReader(strings.NewReader("data"), fmt.Sprintf("src/%02d.txt", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := bucket.CopyFolderWithOptions("src/", "dst/", CopyFolderOptions{Workers: 4})
+	if result.Copied != 8 || result.Failed != 2 || result.Bytes != 32 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	folderErr := &FolderError{}
+	if !errors.As(err, &folderErr) {
+		t.Fatalf("expecting a FolderError, got: %v", err)
+	}
+	if len(folderErr.Errors) != 2 || folderErr.Errors[0].(*ObjectError).Object != "src/03.txt" {
+		t.Errorf("unexpected errors: %v", folderErr)
+	}
+	files, err := bucket.List("dst/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 8 {
+		t.Errorf("expecting 8 copied files, got: %v", files)
+	}
+}
+
+func getLocalBackend(t *testing.T) *LocalFSBackend {
+	backend, err := NewLocalFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
@@ -0,0 +1,507 @@
+package GCPStorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultSyncWorkers is the number of parallel transfers of a sync
+const DefaultSyncWorkers = 8
+
+// MetadataModTime is the metadata key holding the modification time of an
+// uploaded file in unix seconds, the key gsutil rsync uses
+const MetadataModTime = "goog-reserved-file-mtime"
+
+// SyncCompare is how a sync decides that a file changed
+type SyncCompare int
+
+const (
+	// CompareChecksum compares the size and the MD5, or the CRC32C of
+	// objects without MD5
+	CompareChecksum SyncCompare = iota
+	// CompareModTime compares the size and the modification time in seconds,
+	// objects without MetadataModTime use their Updated time
+	CompareModTime
+)
+
+// SyncOptions configure SyncUp and SyncDown
+type SyncOptions struct {
+	Compare SyncCompare
+	// Workers is the number of parallel transfers, zero uses DefaultSyncWorkers
+	Workers int
+	// Delete removes the destination files missing from the source
+	Delete bool
+	// Include and Exclude are path.Match patterns matched against the path
+	// relative to the synced folders and against its base name. With Include
+	// only matching files are synced, files matching Exclude are never synced
+	// nor deleted.
+	Include []string
+	Exclude []string
+	// DryRun reports what the sync would do without changing anything
+	DryRun bool
+}
+
+// SyncReport lists the relative paths a sync handled, in a dry run the
+// paths it would have handled
+type SyncReport struct {
+	Created   []string
+	Updated   []string
+	Deleted   []string
+	Unchanged []string
+	Excluded  []string
+	// Bytes is the size of the created and updated files
+	Bytes  int64
+	DryRun bool
+}
+
+// match reports whether rel is selected by the include and exclude patterns
+func (o *SyncOptions) match(rel string) bool {
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, rel); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(o.Include) > 0 && !matches(o.Include) {
+		return false
+	}
+	return !matches(o.Exclude)
+}
+
+// validate checks the patterns so a typo does not silently select nothing
+func (o *SyncOptions) validate() error {
+	for _, pattern := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("GCPStorage: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// syncer runs a sync between two sets of relative paths, the functions do
+// the comparison and the transfers for a kind of source and destination
+type syncer struct {
+	op   string
+	opts SyncOptions
+	// unchanged reports whether rel is up to date in the destination
+	unchanged func(ctx context.Context, rel string) (bool, error)
+	// transfer copies rel to the destination and returns its size
+	transfer func(ctx context.Context, rel string) (int64, error)
+	// size returns the size of rel in the source
+	size func(rel string) int64
+	// remove deletes rel from the destination
+	remove func(ctx context.Context, rel string) error
+}
+
+func (s *syncer) run(ctx context.Context, srcs, dsts map[string]bool) (SyncReport, error) {
+	report := SyncReport{DryRun: s.opts.DryRun}
+	workers := s.opts.Workers
+	if workers <= 0 {
+		workers = DefaultSyncWorkers
+	}
+	all := []string{}
+	for rel := range srcs {
+		all = append(all, rel)
+	}
+	for rel := range dsts {
+		if !srcs[rel] {
+			all = append(all, rel)
+		}
+	}
+	sort.Strings(all)
+
+	folderErr := &FolderError{Op: s.op}
+	var mu sync.Mutex
+	fail := func(rel string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		folderErr.Errors = append(folderErr.Errors, &ObjectError{Object: rel, Err: err})
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				if !srcs[rel] {
+					if !s.opts.DryRun {
+						if err := s.remove(ctx, rel); err != nil {
+							fail(rel, err)
+							continue
+						}
+					}
+					mu.Lock()
+					report.Deleted = append(report.Deleted, rel)
+					mu.Unlock()
+					continue
+				}
+				list := &report.Created
+				if dsts[rel] {
+					unchanged, err := s.unchanged(ctx, rel)
+					if err != nil {
+						fail(rel, err)
+						continue
+					}
+					list = &report.Updated
+					if unchanged {
+						list = &report.Unchanged
+					}
+				}
+				size := s.size(rel)
+				if list != &report.Unchanged && !s.opts.DryRun {
+					var err error
+					if size, err = s.transfer(ctx, rel); err != nil {
+						fail(rel, err)
+						continue
+					}
+				}
+				mu.Lock()
+				*list = append(*list, rel)
+				if list != &report.Unchanged {
+					report.Bytes += size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	var listErr error
+	for _, rel := range all {
+		if listErr = ctx.Err(); listErr != nil {
+			break
+		}
+		if !s.opts.match(rel) {
+			report.Excluded = append(report.Excluded, rel)
+			continue
+		}
+		if !srcs[rel] && !s.opts.Delete {
+			continue
+		}
+		jobs <- rel
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, list := range [][]string{report.Created, report.Updated, report.Deleted, report.Unchanged} {
+		sort.Strings(list)
+	}
+	sort.Slice(folderErr.Errors, func(i, j int) bool {
+		return folderErr.Errors[i].(*ObjectError).Object < folderErr.Errors[j].(*ObjectError).Object
+	})
+	if listErr != nil {
+		folderErr.Errors = append(folderErr.Errors, listErr)
+	}
+	return report, folderErr.errOrNil()
+}
+
+// listLocal returns the files under dir by their slash separated relative path
+func listLocal(dir string) (map[string]os.FileInfo, error) {
+	files := map[string]os.FileInfo{}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = info
+		}
+		return nil
+	})
+	return files, err
+}
+
+// listRemote returns the objects under prefix by their name relative to it,
+// folder placeholders and the objects under the folder trash are left out
+func listRemote(ctx context.Context, backend Backend, bucket, prefix, trash string) (map[string]*storage.ObjectAttrs, error) {
+	objects := map[string]*storage.ObjectAttrs{}
+	it := backend.Objects(ctx, bucket, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, wrapErr("Objects", prefix, err)
+		}
+		if strings.HasSuffix(attrs.Name, "/") || (trash != "" && strings.HasPrefix(attrs.Name, trash)) {
+			continue
+		}
+		objects[strings.TrimPrefix(attrs.Name, prefix)] = attrs
+	}
+}
+
+// objectModTime returns the modification time recorded by an upload, or the
+// last update of the object
+func objectModTime(attrs *storage.ObjectAttrs) time.Time {
+	if sec, err := strconv.ParseInt(attrs.Metadata[MetadataModTime], 10, 64); err == nil {
+		return time.Unix(sec, 0)
+	}
+	return attrs.Updated
+}
+
+// sameFile reports whether the local file matches the object for compare
+func sameFile(compare SyncCompare, file string, info os.FileInfo, attrs *storage.ObjectAttrs) (bool, error) {
+	if info.Size() != attrs.Size {
+		return false, nil
+	}
+	if compare == CompareModTime {
+		return info.ModTime().Unix() == objectModTime(attrs).Unix(), nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	md5sum, crc, err := fileChecksums(f)
+	if err != nil {
+		return false, err
+	}
+	return verifyChecksums("Sync", attrs.Name, attrs, md5sum, crc) == nil, nil
+}
+
+// SyncUp makes the folder prefix of the bucket a copy of localDir, only new
+// and changed files are uploaded. Uploaded objects record the modification
+// time of their file in MetadataModTime. Failed files do not stop the others,
+// they are returned together as a *FolderError.
+func (b *Bucket) SyncUp(localDir, prefix string, opts SyncOptions) (SyncReport, error) {
+	return b.SyncUpCtx(context.Background(), localDir, prefix, opts)
+}
+
+// SyncUpCtx is SyncUp with a context
+func (b *Bucket) SyncUpCtx(ctx context.Context, localDir, prefix string, opts SyncOptions) (SyncReport, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return SyncReport{}, err
+	}
+	if err := opts.validate(); err != nil {
+		return SyncReport{}, err
+	}
+	prefix = dirPrefix(prefix)
+	files, err := listLocal(localDir)
+	if err != nil {
+		return SyncReport{}, err
+	}
+	objects, err := listRemote(ctx, backend, bucket, prefix, b.trashIn(bucket, prefix))
+	if err != nil {
+		return SyncReport{}, err
+	}
+	localFile := func(rel string) string {
+		return filepath.Join(localDir, filepath.FromSlash(rel))
+	}
+	s := &syncer{
+		op:   "SyncUp",
+		opts: opts,
+		unchanged: func(ctx context.Context, rel string) (bool, error) {
+			return sameFile(opts.Compare, localFile(rel), files[rel], objects[rel])
+		},
+		transfer: func(ctx context.Context, rel string) (int64, error) {
+			info := files[rel]
+			metadata := map[string]string{MetadataModTime: strconv.FormatInt(info.ModTime().Unix(), 10)}
+			_, _, _, err := b.uploadFile(ctx, "SyncUp", localFile(rel), prefix+rel, &WriterOptions{Metadata: metadata})
+			return info.Size(), err
+		},
+		size: func(rel string) int64 {
+			return files[rel].Size()
+		},
+		remove: func(ctx context.Context, rel string) error {
+			return b.DeleteCtx(ctx, prefix+rel)
+		},
+	}
+	srcs, dsts := map[string]bool{}, map[string]bool{}
+	for rel := range files {
+		srcs[rel] = true
+	}
+	for rel := range objects {
+		dsts[rel] = true
+	}
+	return s.run(ctx, srcs, dsts)
+}
+
+// SyncDown makes localDir a copy of the folder prefix of the bucket, only
+// new and changed objects are downloaded. Downloaded files get the
+// modification time of their object. Failed files do not stop the others,
+// they are returned together as a *FolderError.
+func (b *Bucket) SyncDown(prefix, localDir string, opts SyncOptions) (SyncReport, error) {
+	return b.SyncDownCtx(context.Background(), prefix, localDir, opts)
+}
+
+// SyncDownCtx is SyncDown with a context
+func (b *Bucket) SyncDownCtx(ctx context.Context, prefix, localDir string, opts SyncOptions) (SyncReport, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return SyncReport{}, err
+	}
+	if err := opts.validate(); err != nil {
+		return SyncReport{}, err
+	}
+	prefix = dirPrefix(prefix)
+	objects, err := listRemote(ctx, backend, bucket, prefix, b.trashIn(bucket, prefix))
+	if err != nil {
+		return SyncReport{}, err
+	}
+	files, err := listLocal(localDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return SyncReport{}, err
+	}
+	localFile := func(rel string) string {
+		return filepath.Join(localDir, filepath.FromSlash(rel))
+	}
+	s := &syncer{
+		op:   "SyncDown",
+		opts: opts,
+		unchanged: func(ctx context.Context, rel string) (bool, error) {
+			return sameFile(opts.Compare, localFile(rel), files[rel], objects[rel])
+		},
+		transfer: func(ctx context.Context, rel string) (int64, error) {
+			// names like "../a" or "a//b" have no place under localDir
+			if !fs.ValidPath(rel) {
+				return 0, fmt.Errorf("GCPStorage: %q is not a valid local path", rel)
+			}
+			attrs := objects[rel]
+			file := localFile(rel)
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return 0, err
+			}
+			if err := b.DownloadCtx(ctx, attrs.Name, file); err != nil {
+				return 0, err
+			}
+			mtime := objectModTime(attrs)
+			return attrs.Size, os.Chtimes(file, mtime, mtime)
+		},
+		size: func(rel string) int64 {
+			return objects[rel].Size
+		},
+		remove: func(ctx context.Context, rel string) error {
+			return os.Remove(localFile(rel))
+		},
+	}
+	srcs, dsts := map[string]bool{}, map[string]bool{}
+	for rel := range objects {
+		srcs[rel] = true
+	}
+	for rel := range files {
+		dsts[rel] = true
+	}
+	return s.run(ctx, srcs, dsts)
+}
+
+// SyncFolderOptions configure SyncFolder
+type SyncFolderOptions struct {
+	SyncOptions
+	// SrcBucket and DstBucket are the buckets of the folders, empty uses the
+	// current bucket
+	SrcBucket string
+	DstBucket string
+}
+
+// sameObject reports whether dst is a copy of src for compare, with
+// CompareModTime dst is up to date when it is not older than src
+func sameObject(compare SyncCompare, src, dst *storage.ObjectAttrs) bool {
+	if src.Size != dst.Size {
+		return false
+	}
+	if compare == CompareModTime {
+		return !objectModTime(dst).Before(objectModTime(src))
+	}
+	if len(src.MD5) > 0 && len(dst.MD5) > 0 {
+		return bytes.Equal(src.MD5, dst.MD5)
+	}
+	return src.CRC32C == dst.CRC32C
+}
+
+// SyncFolder makes dstFolder a copy of srcFolder, the folders may be in
+// different buckets. Objects are copied server side and only when missing or
+// changed. Failed objects do not stop the others, they are returned together
+// as a *FolderError.
+func (b *Bucket) SyncFolder(srcFolder, dstFolder string, opts SyncFolderOptions) (SyncReport, error) {
+	return b.SyncFolderCtx(context.Background(), srcFolder, dstFolder, opts)
+}
+
+// SyncFolderCtx is SyncFolder with a context
+func (b *Bucket) SyncFolderCtx(ctx context.Context, srcFolder, dstFolder string, opts SyncFolderOptions) (SyncReport, error) {
+	backend, srcBucket, err := b.use()
+	if err != nil {
+		return SyncReport{}, err
+	}
+	if err := opts.validate(); err != nil {
+		return SyncReport{}, err
+	}
+	dstBucket := srcBucket
+	if opts.SrcBucket != "" {
+		srcBucket = opts.SrcBucket
+	}
+	if opts.DstBucket != "" {
+		dstBucket = opts.DstBucket
+	}
+	srcFolder, dstFolder = dirPrefix(srcFolder), dirPrefix(dstFolder)
+	if err := checkNested(srcBucket, srcFolder, dstBucket, dstFolder); err != nil {
+		return SyncReport{}, err
+	}
+	srcs, err := listRemote(ctx, backend, srcBucket, srcFolder, b.trashIn(srcBucket, srcFolder))
+	if err != nil {
+		return SyncReport{}, err
+	}
+	dsts, err := listRemote(ctx, backend, dstBucket, dstFolder, b.trashIn(dstBucket, dstFolder))
+	if err != nil {
+		return SyncReport{}, err
+	}
+	s := &syncer{
+		op:   "SyncFolder",
+		opts: opts.SyncOptions,
+		unchanged: func(ctx context.Context, rel string) (bool, error) {
+			return sameObject(opts.Compare, srcs[rel], dsts[rel]), nil
+		},
+		transfer: func(ctx context.Context, rel string) (int64, error) {
+			attrs, err := backend.Copy(ctx, dstBucket, dstFolder+rel, srcBucket, srcFolder+rel, nil)
+			if err != nil {
+				return 0, wrapErr("CopyFile", srcFolder+rel, err)
+			}
+			return attrs.Size, nil
+		},
+		size: func(rel string) int64 {
+			return srcs[rel].Size
+		},
+		remove: func(ctx context.Context, rel string) error {
+			return b.deleteObject(ctx, backend, dstBucket, dstFolder+rel)
+		},
+	}
+	srcSet, dstSet := map[string]bool{}, map[string]bool{}
+	for rel := range srcs {
+		srcSet[rel] = true
+	}
+	for rel := range dsts {
+		dstSet[rel] = true
+	}
+	return s.run(ctx, srcSet, dstSet)
+}
+
+// checkNested rejects transfers between folders of the same bucket when one
+// contains the other, the listing of the source would see the copies
+func checkNested(srcBucket, srcFolder, dstBucket, dstFolder string) error {
+	if srcBucket == dstBucket && (strings.HasPrefix(srcFolder, dstFolder) || strings.HasPrefix(dstFolder, srcFolder)) {
+		return fmt.Errorf("GCPStorage: %q and %q overlap, one contains the other", srcFolder, dstFolder)
+	}
+	return nil
+}
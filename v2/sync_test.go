@@ -0,0 +1,172 @@
+package GCPStorage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeLocalTree(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncUp(t *testing.T) {
+	bucket := newLocalBucket(t)
+	dir := t.TempDir()
+	writeLocalTree(t, dir, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+		"skip.log":  "log",
+	})
+	putString(t, bucket, "backup/a.txt", "old")
+	putString(t, bucket, "backup/extra.txt", "extra")
+	opts := SyncOptions{Delete: true, Exclude: []string{"*.log"}, DryRun: true}
+
+	report, err := bucket.SyncUp(dir, "backup", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SyncReport{
+		Created:  []string{"sub/b.txt"},
+		Updated:  []string{"a.txt"},
+		Deleted:  []string{"extra.txt"},
+		Excluded: []string{"skip.log"},
+		Bytes:    2,
+		DryRun:   true,
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("expecting %+v, got: %+v", want, report)
+	}
+	if exists, _ := bucket.Exists("backup/extra.txt"); !exists {
+		t.Error("expecting a dry run to keep extra.txt")
+	}
+
+	opts.DryRun = false
+	if _, err := bucket.SyncUp(dir, "backup", opts); err != nil {
+		t.Fatal(err)
+	}
+	files, err := bucket.List("backup/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(files, ",") != "backup/a.txt,backup/sub/b.txt" {
+		t.Errorf("unexpected objects: %v", files)
+	}
+	for _, compare := range []SyncCompare{CompareChecksum, CompareModTime} {
+		report, err = bucket.SyncUp(dir, "backup", SyncOptions{Compare: compare, Exclude: opts.Exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Unchanged) != 2 || report.Bytes != 0 {
+			t.Errorf("expecting everything unchanged with compare %v, got: %+v", compare, report)
+		}
+	}
+}
+
+func TestSyncDown(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "site/index.html", "index")
+	putString(t, bucket, "site/css/main.css", "css")
+	dir := t.TempDir()
+	writeLocalTree(t, dir, map[string]string{"index.html": "stale", "old.html": "old"})
+
+	report, err := bucket.SyncDown("site", dir, SyncOptions{Delete: true, Include: []string{"*.html", "css/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SyncReport{
+		Created: []string{"css/main.css"},
+		Updated: []string{"index.html"},
+		Deleted: []string{"old.html"},
+		Bytes:   8,
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("expecting %+v, got: %+v", want, report)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "index" {
+		t.Errorf("expecting index, got: %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.html")); !os.IsNotExist(err) {
+		t.Errorf("expecting old.html to be deleted, got: %v", err)
+	}
+
+	// downloaded files carry the time of their object
+	report, err = bucket.SyncDown("site", dir, SyncOptions{Compare: CompareModTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unchanged) != 2 {
+		t.Errorf("expecting 2 unchanged files, got: %+v", report)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "index.html"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	report, err = bucket.SyncDown("site", dir, SyncOptions{Compare: CompareModTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Updated, []string{"index.html"}) {
+		t.Errorf("expecting index.html to be updated, got: %+v", report)
+	}
+}
+
+func TestSyncInvalidPattern(t *testing.T) {
+	bucket := newLocalBucket(t)
+	if _, err := bucket.SyncUp(t.TempDir(), "backup", SyncOptions{Include: []string{"["}}); err == nil {
+		t.Error("expecting an invalid pattern error")
+	}
+}
+
+func TestSyncFolder(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "src/a.txt", "a")
+	putString(t, bucket, "src/sub/b.txt", "b")
+	opts := SyncFolderOptions{DstBucket: "other", SyncOptions: SyncOptions{Delete: true}}
+	if _, err := bucket.SyncFolder("src", "dst", opts); err != nil {
+		t.Fatal(err)
+	}
+	other := NewBucketWithBackend("other", bucket.Backend())
+	putString(t, other, "dst/a.txt", "changed")
+	putString(t, other, "dst/extra.txt", "extra")
+
+	report, err := bucket.SyncFolder("src", "dst", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SyncReport{
+		Updated:   []string{"a.txt"},
+		Deleted:   []string{"extra.txt"},
+		Unchanged: []string{"sub/b.txt"},
+		Bytes:     1,
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("expecting %+v, got: %+v", want, report)
+	}
+	files, err := other.List("dst/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(files, ",") != "dst/a.txt,dst/sub/b.txt" {
+		t.Errorf("unexpected objects: %v", files)
+	}
+	if _, err := bucket.SyncFolder("src", "src/copy", SyncFolderOptions{}); err == nil {
+		t.Error("expecting an error syncing a folder into itself")
+	}
+}
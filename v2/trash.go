@@ -0,0 +1,238 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultTrashPrefix is the usual folder of SetTrash
+const DefaultTrashPrefix = ".trash/"
+
+// MetadataTrashOrigin is the path an object in the trash was deleted from
+const MetadataTrashOrigin = "gcpstorage-trash-origin"
+
+// trashTimeFormat names the folder of the objects deleted by one call, it
+// sorts in time order
+const trashTimeFormat = "20060102T150405.000000000Z"
+
+var (
+	// ErrTrashOff is returned by the trash operations when trash mode is off
+	ErrTrashOff = errors.New("GCPStorage: trash mode is off, see SetTrash")
+	// ErrNotInTrash is returned by Restore for an object which was not moved
+	// to the trash
+	ErrNotInTrash = errors.New("GCPStorage: object is not in the trash")
+)
+
+// TrashEntry is an object in the trash
+type TrashEntry struct {
+	// Name is the object in the trash, see Restore
+	Name string
+	// Origin is the path the object was deleted from
+	Origin string
+	// Deleted is when the object was moved to the trash
+	Deleted time.Time
+	Size    int64
+}
+
+// SetTrash turns on trash mode: Delete, DeleteIf, DeleteFolder,
+// DeleteOldFiles and syncs with SyncOptions.Delete move objects to prefix/<timestamp>/<path>
+// instead of deleting them, with their path in the MetadataTrashOrigin
+// metadata. Objects in the trash are deleted for good and are skipped by
+// folder deletes and syncs outside the trash, folder deletes also
+// leave alone objects written or deleted since they were listed. The empty
+// prefix turns trash mode off. The backend must implement VersionedBackend to
+// record the path, deletes fail with ErrNotSupported otherwise. Set it before the bucket is shared between
+// goroutines.
+func (b *Bucket) SetTrash(prefix string) {
+	b.trash = dirPrefix(prefix)
+}
+
+// trashes reports whether deleting name moves it to the trash
+func (b *Bucket) trashes(name string) bool {
+	return b.trash != "" && !strings.HasPrefix(name, b.trash)
+}
+
+// trashIn returns the trash folder to leave out of a listing of prefix in
+// bucket, "" when the listing cannot hold it
+func (b *Bucket) trashIn(bucket, prefix string) string {
+	if bucket != b.bucketName || !b.trashes(prefix) {
+		return ""
+	}
+	return b.trash
+}
+
+// trashFolder returns the folder of the objects deleted at now
+func (b *Bucket) trashFolder(now time.Time) string {
+	return b.trash + now.UTC().Format(trashTimeFormat) + "/"
+}
+
+// moveToTrash moves the generation of attrs under folder of the trash. If
+// attrs.Name changes meanwhile it is kept and the trash copy is deleted.
+func moveToTrash(ctx context.Context, backend Backend, bucket, folder string, attrs *storage.ObjectAttrs) error {
+	versions, ok := backend.(VersionedBackend)
+	if !ok {
+		return ErrNotSupported
+	}
+	metadata := map[string]string{}
+	for k, v := range attrs.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataTrashOrigin] = attrs.Name
+	dst := folder + attrs.Name
+	copied, err := versions.CopyGeneration(ctx, bucket, dst, bucket, attrs.Name, attrs.Generation, &CopyOptions{
+		Metadata:   metadata,
+		Conditions: &Conditions{DoesNotExist: true},
+	})
+	if err != nil {
+		return err
+	}
+	err = backend.Delete(ctx, bucket, attrs.Name, &Conditions{GenerationMatch: attrs.Generation})
+	if err != nil {
+		backend.Delete(context.Background(), bucket, dst, &Conditions{GenerationMatch: copied.Generation})
+	}
+	return err
+}
+
+// trashSkipped reports whether moveToTrash failed because the object changed
+// or was deleted since it was listed, folder deletes leave it alone
+func trashSkipped(err error) bool {
+	kind := errorKind(err)
+	return kind == ErrPreconditionFailed || kind == ErrNotExist
+}
+
+// Restore moves trashObject back to the path it was deleted from and returns
+// that path. An object created at the path since is kept and the error is
+// ErrPreconditionFailed, an object outside the trash is ErrNotInTrash.
+func (b *Bucket) Restore(trashObject string) (string, error) {
+	return b.RestoreCtx(context.Background(), trashObject)
+}
+
+// RestoreCtx is Restore with a context
+func (b *Bucket) RestoreCtx(ctx context.Context, trashObject string) (string, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return "", err
+	}
+	versions, ok := backend.(VersionedBackend)
+	if !ok {
+		return "", ErrNotSupported
+	}
+	if b.trash == "" {
+		return "", ErrTrashOff
+	}
+	notInTrash := &Error{Op: "Restore", Object: trashObject, Kind: ErrNotInTrash, Err: ErrNotInTrash}
+	if !strings.HasPrefix(trashObject, b.trash) {
+		return "", notInTrash
+	}
+	attrs, err := backend.Attrs(ctx, bucket, trashObject)
+	if err != nil {
+		return "", wrapErr("Restore", trashObject, err)
+	}
+	origin := attrs.Metadata[MetadataTrashOrigin]
+	if origin == "" {
+		return "", notInTrash
+	}
+	metadata := map[string]string{}
+	for k, v := range attrs.Metadata {
+		if k != MetadataTrashOrigin {
+			metadata[k] = v
+		}
+	}
+	_, err = versions.CopyGeneration(ctx, bucket, origin, bucket, trashObject, attrs.Generation, &CopyOptions{
+		Metadata:   metadata,
+		Conditions: &Conditions{DoesNotExist: true},
+	})
+	if err != nil {
+		return "", wrapErr("Restore", origin, err)
+	}
+	err = backend.Delete(ctx, bucket, trashObject, &Conditions{GenerationMatch: attrs.Generation})
+	return origin, wrapErr("Restore", trashObject, err)
+}
+
+// ListTrash lists the objects in the trash, oldest deletes first
+func (b *Bucket) ListTrash() ([]TrashEntry, error) {
+	return b.ListTrashCtx(context.Background())
+}
+
+// ListTrashCtx is ListTrash with a context
+func (b *Bucket) ListTrashCtx(ctx context.Context) ([]TrashEntry, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return nil, err
+	}
+	if b.trash == "" {
+		return nil, ErrTrashOff
+	}
+	entries := []TrashEntry{}
+	it := backend.Objects(ctx, bucket, &storage.Query{Prefix: b.trash})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, wrapErr("ListTrash", b.trash, err)
+		}
+		entries = append(entries, TrashEntry{
+			Name:    attrs.Name,
+			Origin:  attrs.Metadata[MetadataTrashOrigin],
+			Deleted: b.trashTime(attrs),
+			Size:    attrs.Size,
+		})
+	}
+}
+
+// trashTime returns when the object of attrs was moved to the trash, from its
+// folder or else from its creation
+func (b *Bucket) trashTime(attrs *storage.ObjectAttrs) time.Time {
+	stamp := strings.TrimPrefix(attrs.Name, b.trash)
+	if i := strings.Index(stamp, "/"); i >= 0 {
+		if t, err := time.Parse(trashTimeFormat, stamp[:i]); err == nil {
+			return t
+		}
+	}
+	return attrs.Created
+}
+
+// PurgeTrash deletes for good the objects moved to the trash more than
+// olderThan ago
+func (b *Bucket) PurgeTrash(olderThan time.Duration) error {
+	return b.PurgeTrashCtx(context.Background(), olderThan)
+}
+
+// PurgeTrashCtx is PurgeTrash with a context, ctx is checked between objects
+func (b *Bucket) PurgeTrashCtx(ctx context.Context, olderThan time.Duration) error {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return err
+	}
+	if b.trash == "" {
+		return ErrTrashOff
+	}
+	it := backend.Objects(ctx, bucket, &storage.Query{Prefix: b.trash})
+	now := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return wrapErr("PurgeTrash", b.trash, err)
+		}
+		if now.Sub(b.trashTime(attrs)) <= olderThan {
+			continue
+		}
+		err = backend.Delete(ctx, bucket, attrs.Name, &Conditions{GenerationMatch: attrs.Generation})
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return wrapErr("Delete", attrs.Name, err)
+		}
+	}
+}
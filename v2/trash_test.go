@@ -0,0 +1,190 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestTrash(t *testing.T) {
+	bucket := newLocalBucket(t)
+	bucket.SetTrash(DefaultTrashPrefix)
+	putString(t, bucket, "docs/a.txt", "a")
+	putString(t, bucket, "docs/b.txt", "b")
+	putString(t, bucket, "keep.txt", "keep")
+	if err := bucket.Delete("keep.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.DeleteFolder(""); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := bucket.List("", 0); len(files) != 3 {
+		t.Fatalf("expecting only the trash to be left, got: %v", files)
+	}
+	entries, err := bucket.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	origins := map[string]string{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name, DefaultTrashPrefix) || time.Since(entry.Deleted) > time.Minute {
+			t.Errorf("unexpected trash entry %+v", entry)
+		}
+		origins[entry.Origin] = entry.Name
+	}
+	if len(origins) != 3 || origins["docs/a.txt"] == "" {
+		t.Fatalf("expecting the 3 deleted objects, got: %v", entries)
+	}
+
+	origin, err := bucket.Restore(origins["docs/a.txt"])
+	if err != nil || origin != "docs/a.txt" {
+		t.Fatalf("expecting docs/a.txt to be restored, got: %v %v", origin, err)
+	}
+	attrs, err := bucket.Attrs("docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := attrs.Metadata[MetadataTrashOrigin]; ok {
+		t.Errorf("expecting the trash metadata to be removed, got: %v", attrs.Metadata)
+	}
+	// a new keep.txt is not replaced by the restore
+	putString(t, bucket, "keep.txt", "new")
+	if _, err := bucket.Restore(origins["keep.txt"]); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed, got: %v", err)
+	}
+
+	if _, err := bucket.Restore("keep.txt"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("expecting ErrNotInTrash, got: %v", err)
+	}
+	putString(t, bucket, DefaultTrashPrefix+"stray.txt", "stray")
+	if _, err := bucket.Restore(DefaultTrashPrefix + "stray.txt"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("expecting ErrNotInTrash, got: %v", err)
+	}
+	if err := bucket.Delete(DefaultTrashPrefix + "stray.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.PurgeTrash(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := bucket.ListTrash(); len(entries) != 2 {
+		t.Errorf("expecting recent deletes to be kept, got: %v", entries)
+	}
+	if err := bucket.PurgeTrash(0); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := bucket.ListTrash(); len(entries) != 0 {
+		t.Errorf("expecting the trash to be empty, got: %v", entries)
+	}
+}
+
+func TestTrashOff(t *testing.T) {
+	bucket := newLocalBucket(t)
+	putString(t, bucket, "file.txt", "data")
+	if err := bucket.Delete("file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := bucket.List("", 0); len(files) != 0 {
+		t.Errorf("expecting file.txt to be deleted for good, got: %v", files)
+	}
+	if _, err := bucket.ListTrash(); err != ErrTrashOff {
+		t.Errorf("expecting ErrTrashOff, got: %v", err)
+	}
+}
+
+// rewritingBackend writes a new generation of an object before copying it
+type rewritingBackend struct {
+	*LocalFSBackend
+	object string
+}
+
+func (r *rewritingBackend) CopyGeneration(ctx context.Context, dstBucket, dst, srcBucket, src string, generation int64, opts *CopyOptions) (*storage.ObjectAttrs, error) {
+	if src == r.object {
+		writeObject(ctx, r.LocalFSBackend, srcBucket, src, strings.NewReader("new"), nil)
+	}
+	return r.LocalFSBackend.CopyGeneration(ctx, dstBucket, dst, srcBucket, src, generation, opts)
+}
+
+func TestTrashSkipsChanged(t *testing.T) {
+	local := newLocalBucket(t)
+	putString(t, local, "docs/a.txt", "a")
+	putString(t, local, "docs/b.txt", "b")
+	bucket := NewBucketWithBackend("local", &rewritingBackend{local.Backend().(*LocalFSBackend), "docs/a.txt"})
+	bucket.SetTrash(DefaultTrashPrefix)
+	if err := bucket.DeleteFolder("docs/"); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := bucket.List("docs/", 0); len(files) != 1 || files[0] != "docs/a.txt" {
+		t.Errorf("expecting the rewritten docs/a.txt to be kept, got: %v", files)
+	}
+	if entries, _ := bucket.ListTrash(); len(entries) != 1 || entries[0].Origin != "docs/b.txt" {
+		t.Errorf("expecting docs/b.txt in the trash, got: %v", entries)
+	}
+}
+
+func TestTrashSync(t *testing.T) {
+	bucket := newLocalBucket(t)
+	bucket.SetTrash(DefaultTrashPrefix)
+	putString(t, bucket, "old.txt", "old")
+	if err := bucket.Delete("old.txt"); err != nil {
+		t.Fatal(err)
+	}
+	localDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(localDir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the trash is not part of the synced root
+	if _, err := bucket.SyncUp(localDir, "", SyncOptions{Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := bucket.ListTrash(); err != nil || len(entries) != 1 {
+		t.Fatalf("expecting the trash to be kept, got: %v %v", entries, err)
+	}
+	downDir := t.TempDir()
+	report, err := bucket.SyncDown("", downDir, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(report.Created, ",") != "new.txt" {
+		t.Errorf("expecting only new.txt to be downloaded, got: %v", report.Created)
+	}
+
+	putString(t, bucket, "dst/extra.txt", "extra")
+	if _, err := bucket.SyncFolder("src/", "dst/", SyncFolderOptions{SyncOptions: SyncOptions{Delete: true}}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := bucket.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expecting dst/extra.txt to be moved to the trash, got: %v", entries)
+	}
+}
+
+func TestTrashDeleteIf(t *testing.T) {
+	bucket := newLocalBucket(t)
+	bucket.SetTrash(DefaultTrashPrefix)
+	attrs, err := bucket.UploadFromReaderIf(strings.NewReader("v1"), "doc", Conditions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.DeleteIf("doc", Conditions{GenerationMatch: attrs.Generation + 1}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expecting ErrPreconditionFailed, got: %v", err)
+	}
+	if err := bucket.DeleteIf("doc", Conditions{GenerationMatch: attrs.Generation}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := bucket.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Origin != "doc" {
+		t.Errorf("expecting doc to be moved to the trash, got: %v", entries)
+	}
+}
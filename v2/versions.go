@@ -0,0 +1,124 @@
+package GCPStorage
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// versioned returns the backend of the bucket if it keeps generations,
+// ErrNotSupported otherwise
+func (b *Bucket) versioned() (VersionedBackend, string, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return nil, "", err
+	}
+	versions, ok := backend.(VersionedBackend)
+	if !ok {
+		return nil, "", ErrNotSupported
+	}
+	return versions, bucket, nil
+}
+
+// ListVersions lists every generation of the objects under prefix, by name
+// and oldest generation first. Noncurrent generations, which were replaced
+// or deleted, have Deleted set. A bucket without versioning lists its live
+// objects only.
+func (b *Bucket) ListVersions(prefix string) ([]*storage.ObjectAttrs, error) {
+	return b.ListVersionsCtx(context.Background(), prefix)
+}
+
+// ListVersionsCtx is ListVersions with a context
+func (b *Bucket) ListVersionsCtx(ctx context.Context, prefix string) ([]*storage.ObjectAttrs, error) {
+	backend, bucket, err := b.use()
+	if err != nil {
+		return nil, err
+	}
+	versions := []*storage.ObjectAttrs{}
+	it := backend.Objects(ctx, bucket, &storage.Query{Prefix: prefix, Versions: true})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, wrapErr("ListVersions", prefix, err)
+		}
+		versions = append(versions, attrs)
+	}
+}
+
+// GetVersionReader is GetFileReader for generation of object, live or
+// noncurrent. The caller closes the reader.
+func (b *Bucket) GetVersionReader(object string, generation int64) (io.ReadCloser, error) {
+	return b.GetVersionReaderCtx(context.Background(), object, generation)
+}
+
+// GetVersionReaderCtx is GetVersionReader with a context
+func (b *Bucket) GetVersionReaderCtx(ctx context.Context, object string, generation int64) (io.ReadCloser, error) {
+	backend, bucket, err := b.versioned()
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := backend.GenerationAttrs(ctx, bucket, object, generation)
+	if err != nil {
+		return nil, wrapErr("NewReader", object, err)
+	}
+	reader, err := backend.NewGenerationReader(ctx, bucket, object, generation, 0, -1)
+	if err != nil {
+		return nil, wrapErr("NewReader", object, err)
+	}
+	return newChecksumReader(reader, attrs), nil
+}
+
+// DownloadVersion is Download for generation of src
+func (b *Bucket) DownloadVersion(src string, generation int64, dst string) error {
+	return b.DownloadVersionCtx(context.Background(), src, generation, dst)
+}
+
+// DownloadVersionCtx is DownloadVersion with a context
+func (b *Bucket) DownloadVersionCtx(ctx context.Context, src string, generation int64, dst string) error {
+	reader, err := b.GetVersionReaderCtx(ctx, src, generation)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return downloadTo(reader, dst)
+}
+
+// RestoreVersion makes generation of object its live version again by
+// copying it over the live object, the replaced live object becomes
+// noncurrent. It returns the attributes of the new live generation.
+func (b *Bucket) RestoreVersion(object string, generation int64) (*storage.ObjectAttrs, error) {
+	return b.RestoreVersionCtx(context.Background(), object, generation)
+}
+
+// RestoreVersionCtx is RestoreVersion with a context
+func (b *Bucket) RestoreVersionCtx(ctx context.Context, object string, generation int64) (*storage.ObjectAttrs, error) {
+	backend, bucket, err := b.versioned()
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := backend.CopyGeneration(ctx, bucket, object, bucket, object, generation, nil)
+	if err != nil {
+		return nil, wrapErr("RestoreVersion", object, err)
+	}
+	return attrs, nil
+}
+
+// DeleteVersion removes generation of object for good, unlike Delete which
+// keeps the live object as a noncurrent version on a versioned bucket
+func (b *Bucket) DeleteVersion(object string, generation int64) error {
+	return b.DeleteVersionCtx(context.Background(), object, generation)
+}
+
+// DeleteVersionCtx is DeleteVersion with a context
+func (b *Bucket) DeleteVersionCtx(ctx context.Context, object string, generation int64) error {
+	backend, bucket, err := b.versioned()
+	if err != nil {
+		return err
+	}
+	return wrapErr("DeleteVersion", object, backend.DeleteGeneration(ctx, bucket, object, generation))
+}
@@ -0,0 +1,256 @@
+package GCPStorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WriteFS is a file system that can be modified, *FS implements it on a
+// bucket and *DirFS on a local directory so code written against WriteFS can
+// move between them
+type WriteFS interface {
+	fs.FS
+	// Create creates or truncates the file name and creates its missing
+	// parent folders, the file is written on Close
+	Create(name string) (io.WriteCloser, error)
+	// Rename moves a file or a folder
+	Rename(oldname, newname string) error
+	// Remove removes a file or an empty folder
+	Remove(name string) error
+	// RemoveAll removes name and everything under it, a missing name is not an error
+	RemoveAll(name string) error
+	// MkdirAll creates the folder name and its parents
+	MkdirAll(name string) error
+}
+
+var (
+	_ WriteFS = (*FS)(nil)
+	_ WriteFS = (*DirFS)(nil)
+)
+
+// errNotEmpty is returned when removing a folder which has content
+var errNotEmpty = errors.New("directory not empty")
+
+// writablePath rejects invalid paths and the root, which cannot be replaced or removed
+func writablePath(op, name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// fsWriter uploads a file of an FS, cancelling the upload if Close is not reached
+type fsWriter struct {
+	w      ObjectWriter
+	cancel context.CancelFunc
+	name   string
+	object string
+}
+
+func (w *fsWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.cancel()
+		return n, pathError("write", w.name, wrapErr("Create", w.object, err))
+	}
+	return n, nil
+}
+
+func (w *fsWriter) Close() error {
+	defer w.cancel()
+	if err := w.w.Close(); err != nil {
+		return pathError("close", w.name, wrapErr("Create", w.object, err))
+	}
+	return nil
+}
+
+// Create implements WriteFS, the object is uploaded like UploadFromReader
+func (fsys *FS) Create(name string) (io.WriteCloser, error) {
+	if err := writablePath("create", name); err != nil {
+		return nil, err
+	}
+	backend, bucket, err := fsys.bucket.use()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(fsys.ctx)
+	object := fsys.object(name)
+	return &fsWriter{w: backend.NewWriter(ctx, bucket, object, nil), cancel: cancel, name: name, object: object}, nil
+}
+
+// Rename implements WriteFS with Move, folders are moved object by object
+// with MoveFolder
+func (fsys *FS) Rename(oldname, newname string) error {
+	if err := writablePath("rename", oldname); err != nil {
+		return err
+	}
+	if err := writablePath("rename", newname); err != nil {
+		return err
+	}
+	info, err := fsys.stat("rename", oldname)
+	if err != nil {
+		return err
+	}
+	src, dst := fsys.object(oldname), fsys.object(newname)
+	if info.IsDir() {
+		_, err = fsys.bucket.MoveFolderCtx(fsys.ctx, src+"/", dst+"/", CopyFolderOptions{})
+	} else {
+		err = fsys.bucket.MoveCtx(fsys.ctx, src, dst)
+	}
+	if err != nil {
+		return pathError("rename", oldname, err)
+	}
+	return nil
+}
+
+// Remove implements WriteFS, removing a folder deletes its placeholder object
+func (fsys *FS) Remove(name string) error {
+	if err := writablePath("remove", name); err != nil {
+		return err
+	}
+	info, err := fsys.stat("remove", name)
+	if err != nil {
+		return err
+	}
+	object := fsys.object(name)
+	if info.IsDir() {
+		entries, err := fsys.bucket.ListDirCtx(fsys.ctx, object)
+		if err != nil {
+			return pathError("remove", name, err)
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+		}
+		object += "/"
+	}
+	if err := fsys.bucket.DeleteCtx(fsys.ctx, object); err != nil {
+		return pathError("remove", name, err)
+	}
+	return nil
+}
+
+// RemoveAll implements WriteFS with Delete and DeleteFolder
+func (fsys *FS) RemoveAll(name string) error {
+	if err := writablePath("removeall", name); err != nil {
+		return err
+	}
+	object := fsys.object(name)
+	if err := fsys.bucket.DeleteCtx(fsys.ctx, object); err != nil && !errors.Is(err, ErrNotExist) {
+		return pathError("removeall", name, err)
+	}
+	if err := fsys.bucket.DeleteFolderCtx(fsys.ctx, object+"/"); err != nil {
+		return pathError("removeall", name, err)
+	}
+	return nil
+}
+
+// MkdirAll implements WriteFS, every missing folder of name gets an empty
+// placeholder object named like the folder, e.g. "a/" and "a/b/"
+func (fsys *FS) MkdirAll(name string) error {
+	if name == "." {
+		return nil
+	}
+	if err := writablePath("mkdir", name); err != nil {
+		return err
+	}
+	dir := ""
+	for _, part := range strings.Split(name, "/") {
+		dir = path.Join(dir, part)
+		info, err := fsys.stat("mkdir", dir)
+		if err == nil {
+			if !info.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+			}
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		err = fsys.bucket.UploadFromReaderCtx(fsys.ctx, strings.NewReader(""), fsys.object(dir)+"/")
+		if err != nil {
+			return pathError("mkdir", dir, err)
+		}
+	}
+	return nil
+}
+
+// DirFS is a WriteFS over a local directory, the counterpart of FS for code
+// which runs against local disk or a bucket
+type DirFS struct {
+	fs.FS
+	dir string
+}
+
+// NewDirFS returns the directory dir as a WriteFS
+func NewDirFS(dir string) *DirFS {
+	return &DirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+// path returns the local path of name
+func (d *DirFS) path(op, name string) (string, error) {
+	if err := writablePath(op, name); err != nil {
+		return "", err
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(name)), nil
+}
+
+// Create implements WriteFS
+func (d *DirFS) Create(name string) (io.WriteCloser, error) {
+	p, err := d.path("create", name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
+
+// Rename implements WriteFS
+func (d *DirFS) Rename(oldname, newname string) error {
+	oldpath, err := d.path("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newpath, err := d.path("rename", newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldpath, newpath)
+}
+
+// Remove implements WriteFS
+func (d *DirFS) Remove(name string) error {
+	p, err := d.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// RemoveAll implements WriteFS
+func (d *DirFS) RemoveAll(name string) error {
+	p, err := d.path("removeall", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+// MkdirAll implements WriteFS
+func (d *DirFS) MkdirAll(name string) error {
+	if name == "." {
+		return nil
+	}
+	p, err := d.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0755)
+}